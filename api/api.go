@@ -0,0 +1,297 @@
+package api
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/modelo"
+)
+
+const Prefijo = "/api/v1/"
+
+// Los eventos de lo que se hace desde la API no tienen cuenta de Telegram
+const cuentaDeLaAPI = 0
+
+//go:embed openapi.yaml
+var descripcion []byte
+
+// Avisa por Telegram lo que se hace desde la API, igual que si se hubiera
+// pedido en el grupo. No espera a que se manden los mensajes, la API responde
+// 202 apenas queda todo guardado
+type Notificador interface {
+	AnunciarSorteo(grupo *modelo.Grupo, sorteados []*modelo.Participante)
+	MandarAmigxs(grupo *modelo.Grupo, sorteados []*modelo.Participante)
+}
+
+// API JSON para armar un tablero web sobre los juegos. Usa los mismos métodos
+// de La Maga que el bot, nunca muestra a quién le regala cada une y todas las
+// rutas menos la descripción piden el token en Authorization: Bearer <token>
+type API struct {
+	maga        *lamaga.LaMaga
+	token       string
+	notificador Notificador
+	registro    *bitacora.Bitacora
+}
+
+type Grupo struct {
+	ID                      uint       `json:"id"`
+	Chat                    int64      `json:"chat"`
+	Juego                   string     `json:"juego"`
+	Nombre                  string     `json:"nombre"`
+	Organizador             int        `json:"organizador"`
+	Estado                  string     `json:"estado"`
+	Fecha                   *time.Time `json:"fecha,omitempty"`
+	RegalosPorPersona       int        `json:"regalosPorPersona"`
+	CantidadDeParticipantes int        `json:"cantidadDeParticipantes"`
+	SinNotificar            int        `json:"sinNotificar"`
+}
+
+type Participante struct {
+	ID           uint   `json:"id"`
+	Nombre       string `json:"nombre"`
+	Usuario      string `json:"usuario,omitempty"`
+	Telegram     int    `json:"telegram,omitempty"`
+	Responsable  int    `json:"responsable,omitempty"`
+	Equipo       string `json:"equipo,omitempty"`
+	SeFue        bool   `json:"seFue"`
+	Compro       bool   `json:"compro"`
+	Recibio      bool   `json:"recibio"`
+	Notificacion string `json:"notificacion,omitempty"`
+}
+
+type DetalleDeGrupo struct {
+	Grupo
+	Participantes []Participante `json:"participantes"`
+}
+
+type Notificaciones struct {
+	Notificaciones int `json:"notificaciones"`
+}
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+const (
+	EstadoSinSortear = "sinSortear"
+	EstadoSorteado   = "sorteado"
+	EstadoRevelado   = "revelado"
+	EstadoTerminado  = "terminado"
+)
+
+func NewAPI(maga *lamaga.LaMaga, token string, notificador Notificador, registro *bitacora.Bitacora) *API {
+	return &API{maga: maga, token: token, notificador: notificador, registro: registro}
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ruta := strings.Trim(strings.TrimPrefix(r.URL.Path, Prefijo), "/")
+	if ruta == "openapi.yaml" {
+		if permitir(w, r, http.MethodGet) {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(descripcion)
+		}
+		return
+	}
+
+	if !a.autorizado(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		responderError(w, http.StatusUnauthorized, "noAutorizado")
+		return
+	}
+
+	partes := strings.Split(ruta, "/")
+	if partes[0] != "grupos" || len(partes) > 3 {
+		responderError(w, http.StatusNotFound, "rutaDesconocida")
+		return
+	}
+	if len(partes) == 1 {
+		if permitir(w, r, http.MethodGet) {
+			a.listarGrupos(w, r)
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(partes[1], 10, 0)
+	if err != nil {
+		responderError(w, http.StatusNotFound, "noExisteElJuego")
+		return
+	}
+	accion := ""
+	if len(partes) == 3 {
+		accion = partes[2]
+	}
+	switch accion {
+	case "":
+		if permitir(w, r, http.MethodGet) {
+			a.mostrarGrupo(w, r, uint(id))
+		}
+	case "sorteo":
+		if permitir(w, r, http.MethodPost) {
+			a.sortear(w, r, uint(id))
+		}
+	case "notificaciones":
+		if permitir(w, r, http.MethodPost) {
+			a.notificar(w, r, uint(id))
+		}
+	default:
+		responderError(w, http.StatusNotFound, "rutaDesconocida")
+	}
+}
+
+func (a *API) autorizado(r *http.Request) bool {
+	encabezado := r.Header.Get("Authorization")
+	if !strings.HasPrefix(encabezado, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(encabezado, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *API) listarGrupos(w http.ResponseWriter, r *http.Request) {
+	resumenes, err := a.maga.ResumenDeJuegos()
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+
+	grupos := make([]Grupo, 0, len(resumenes))
+	for _, resumen := range resumenes {
+		grupos = append(grupos, grupoDe(resumen))
+	}
+	responder(w, http.StatusOK, grupos)
+}
+
+func (a *API) mostrarGrupo(w http.ResponseWriter, r *http.Request, id uint) {
+	resumen, err := a.maga.ResumenDelJuego(id)
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+	responder(w, http.StatusOK, detalleDe(*resumen))
+}
+
+func (a *API) sortear(w http.ResponseWriter, r *http.Request, id uint) {
+	sorteados, err := a.maga.ConBitacora(a.registro.Con("ruta", r.URL.Path)).SortearPorID(id, cuentaDeLaAPI)
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+
+	resumen, err := a.maga.ResumenDelJuego(id)
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+	a.notificador.AnunciarSorteo(resumen.Grupo, sorteados)
+	responder(w, http.StatusAccepted, detalleDe(*resumen))
+}
+
+func (a *API) notificar(w http.ResponseWriter, r *http.Request, id uint) {
+	sorteados, err := a.maga.RenotificarPorID(id, cuentaDeLaAPI)
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+
+	resumen, err := a.maga.ResumenDelJuego(id)
+	if err != nil {
+		a.fallo(w, r, err)
+		return
+	}
+	a.notificador.MandarAmigxs(resumen.Grupo, sorteados)
+	notificaciones := 0
+	for _, participante := range sorteados {
+		if !participante.SeFue {
+			notificaciones++
+		}
+	}
+	responder(w, http.StatusAccepted, Notificaciones{Notificaciones: notificaciones})
+}
+
+var estadosPorError = map[string]int{
+	"noExisteElJuego":     http.StatusNotFound,
+	"juegoTerminado":      http.StatusConflict,
+	"yaSorteado":          http.StatusConflict,
+	"noSorteado":          http.StatusConflict,
+	"faltanParticipantes": http.StatusConflict,
+	"sorteoImposible":     http.StatusConflict,
+}
+
+func (a *API) fallo(w http.ResponseWriter, r *http.Request, err error) {
+	estado, conocido := estadosPorError[err.Error()]
+	if !conocido {
+		a.registro.Con("ruta", r.URL.Path).Con("metodo", r.Method).Error("Error en la API", err)
+		responderError(w, http.StatusInternalServerError, "error")
+		return
+	}
+	responderError(w, estado, err.Error())
+}
+
+func permitir(w http.ResponseWriter, r *http.Request, metodo string) bool {
+	if r.Method == metodo {
+		return true
+	}
+	w.Header().Set("Allow", metodo)
+	responderError(w, http.StatusMethodNotAllowed, "metodoNoPermitido")
+	return false
+}
+
+func responder(w http.ResponseWriter, estado int, cuerpo interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(estado)
+	json.NewEncoder(w).Encode(cuerpo)
+}
+
+func responderError(w http.ResponseWriter, estado int, err string) {
+	responder(w, estado, Error{Error: err})
+}
+
+func grupoDe(resumen lamaga.ResumenDeJuego) Grupo {
+	grupo := resumen.Grupo
+	estado := EstadoSinSortear
+	if grupo.ArchivadoEn.Valid {
+		estado = EstadoTerminado
+	} else if grupo.Revelado {
+		estado = EstadoRevelado
+	} else if grupo.YaSorteo {
+		estado = EstadoSorteado
+	}
+	return Grupo{
+		ID:                      grupo.ID,
+		Chat:                    grupo.Identificador,
+		Juego:                   grupo.Juego,
+		Nombre:                  grupo.Nombre,
+		Organizador:             grupo.Organizador,
+		Estado:                  estado,
+		Fecha:                   grupo.Fecha,
+		RegalosPorPersona:       grupo.Regalos(),
+		CantidadDeParticipantes: resumen.Participantes,
+		SinNotificar:            resumen.SinNotificar,
+	}
+}
+
+func detalleDe(resumen lamaga.ResumenDeJuego) DetalleDeGrupo {
+	detalle := DetalleDeGrupo{Grupo: grupoDe(resumen), Participantes: make([]Participante, 0, len(resumen.Grupo.Participantes))}
+	for _, participante := range resumen.Grupo.Participantes {
+		detalle.Participantes = append(detalle.Participantes, Participante{
+			ID:           participante.ID,
+			Nombre:       participante.Nombre,
+			Usuario:      participante.Usuario,
+			Telegram:     participante.Identificador,
+			Responsable:  participante.Responsable,
+			Equipo:       participante.Equipo,
+			SeFue:        participante.SeFue,
+			Compro:       participante.Compro,
+			Recibio:      participante.Recibio,
+			Notificacion: participante.Notificacion.Estado,
+		})
+	}
+	return detalle
+}
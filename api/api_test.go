@@ -0,0 +1,275 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/api"
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/telegram"
+	"github.com/stretchr/testify/suite"
+	tb "gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const token = "un-token-de-prueba-bien-largo-para-la-api"
+
+const IDOrganizador = 1
+
+type notificadorDePrueba struct {
+	anunciados []*modelo.Grupo
+	mandados   []*modelo.Grupo
+}
+
+func (n *notificadorDePrueba) AnunciarSorteo(grupo *modelo.Grupo, sorteados []*modelo.Participante) {
+	n.anunciados = append(n.anunciados, grupo)
+}
+
+func (n *notificadorDePrueba) MandarAmigxs(grupo *modelo.Grupo, sorteados []*modelo.Participante) {
+	n.mandados = append(n.mandados, grupo)
+}
+
+// Se queda trabado en cada mensaje hasta que lo suelten, como un Telegram que
+// no contesta
+type enviadorTrabado struct {
+	soltar chan struct{}
+}
+
+func (e *enviadorTrabado) Send(to tb.Recipient, what interface{}, options ...interface{}) (*tb.Message, error) {
+	<-e.soltar
+	return &tb.Message{}, nil
+}
+
+func (e *enviadorTrabado) Edit(msg tb.Editable, what interface{}, options ...interface{}) (*tb.Message, error) {
+	<-e.soltar
+	return &tb.Message{}, nil
+}
+
+func (e *enviadorTrabado) Respond(c *tb.Callback, resp ...*tb.CallbackResponse) error {
+	return nil
+}
+
+type APITestSuite struct {
+	suite.Suite
+	maga        *lamaga.LaMaga
+	notificador *notificadorDePrueba
+	api         *api.API
+	grupo       int64
+	id          string
+}
+
+func (suite *APITestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:api%d?mode=memory&cache=shared", rand.Int())), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.NoError(err, "Debería conectarse a la base de datos")
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "Debería ejecutar las migraciones")
+
+	suite.maga = lamaga.NewMaga(db)
+	suite.notificador = &notificadorDePrueba{}
+	suite.api = api.NewAPI(suite.maga, token, suite.notificador, bitacora.Descartar())
+
+	suite.grupo = int64(rand.Int())
+	suite.NoError(suite.maga.NuevoGrupo(suite.grupo, "", "Mi grupo", IDOrganizador))
+	suite.NoError(suite.maga.NuevoParticipante(suite.grupo, "", IDOrganizador, "Nick"))
+	suite.NoError(suite.maga.NuevoParticipante(suite.grupo, "", 2, "Nay"))
+	suite.NoError(suite.maga.NuevoParticipante(suite.grupo, "", 3, "Juli"))
+	grupo, err := suite.maga.Juego(suite.grupo, "")
+	suite.NoError(err)
+	suite.id = strconv.FormatUint(uint64(grupo.ID), 10)
+}
+
+func (suite *APITestSuite) pedir(metodo string, ruta string, conToken bool) *httptest.ResponseRecorder {
+	pedido := httptest.NewRequest(metodo, api.Prefijo+ruta, nil)
+	if conToken {
+		pedido.Header.Set("Authorization", "Bearer "+token)
+	}
+	respuesta := httptest.NewRecorder()
+	suite.api.ServeHTTP(respuesta, pedido)
+	return respuesta
+}
+
+func (suite *APITestSuite) leer(respuesta *httptest.ResponseRecorder, cuerpo interface{}) {
+	suite.Equal("application/json", respuesta.Header().Get("Content-Type"))
+	suite.NoError(json.Unmarshal(respuesta.Body.Bytes(), cuerpo), "Debería responder JSON")
+}
+
+func (suite *APITestSuite) TestSinTokenNoMuestraNada() {
+	respuesta := suite.pedir(http.MethodGet, "grupos", false)
+	suite.Equal(http.StatusUnauthorized, respuesta.Code)
+	suite.Equal("Bearer", respuesta.Header().Get("WWW-Authenticate"))
+	fallo := api.Error{}
+	suite.leer(respuesta, &fallo)
+	suite.Equal("noAutorizado", fallo.Error)
+
+	pedido := httptest.NewRequest(http.MethodGet, api.Prefijo+"grupos", nil)
+	pedido.Header.Set("Authorization", "Bearer otro-token")
+	respuesta = httptest.NewRecorder()
+	suite.api.ServeHTTP(respuesta, pedido)
+	suite.Equal(http.StatusUnauthorized, respuesta.Code, "No debería aceptar otro token")
+}
+
+func (suite *APITestSuite) TestLaDescripcionNoPideToken() {
+	respuesta := suite.pedir(http.MethodGet, "openapi.yaml", false)
+	suite.Equal(http.StatusOK, respuesta.Code)
+	suite.Contains(respuesta.Body.String(), "openapi: 3")
+}
+
+func (suite *APITestSuite) TestListaLosGrupos() {
+	respuesta := suite.pedir(http.MethodGet, "grupos", true)
+	suite.Equal(http.StatusOK, respuesta.Code)
+
+	grupos := make([]api.Grupo, 0)
+	suite.leer(respuesta, &grupos)
+	var grupo *api.Grupo
+	for i := range grupos {
+		if grupos[i].Chat == suite.grupo {
+			grupo = &grupos[i]
+		}
+	}
+	suite.Require().NotNil(grupo, "Debería estar el grupo")
+	suite.Equal("Mi grupo", grupo.Nombre)
+	suite.Equal(api.EstadoSinSortear, grupo.Estado)
+	suite.Equal(3, grupo.CantidadDeParticipantes)
+	suite.Equal(1, grupo.RegalosPorPersona)
+}
+
+func (suite *APITestSuite) TestMuestraUnGrupoSinLosRegalos() {
+	_, err := suite.maga.Sortear(suite.grupo, "", IDOrganizador)
+	suite.NoError(err)
+
+	respuesta := suite.pedir(http.MethodGet, "grupos/"+suite.id, true)
+	suite.Equal(http.StatusOK, respuesta.Code)
+
+	detalle := api.DetalleDeGrupo{}
+	suite.leer(respuesta, &detalle)
+	suite.Equal(api.EstadoSorteado, detalle.Estado)
+	suite.Equal(3, detalle.SinNotificar)
+	suite.Len(detalle.Participantes, 3)
+	suite.Equal("Nick", detalle.Participantes[0].Nombre)
+	suite.Equal(IDOrganizador, detalle.Participantes[0].Telegram)
+	suite.NotContains(respuesta.Body.String(), "amigx", "No debería mostrar a quién le regala cada une")
+}
+
+func (suite *APITestSuite) TestNoEncuentraGruposNiRutasQueNoExisten() {
+	respuesta := suite.pedir(http.MethodGet, "grupos/999999", true)
+	suite.Equal(http.StatusNotFound, respuesta.Code)
+	fallo := api.Error{}
+	suite.leer(respuesta, &fallo)
+	suite.Equal("noExisteElJuego", fallo.Error)
+
+	suite.Equal(http.StatusNotFound, suite.pedir(http.MethodGet, "grupos/abc", true).Code)
+	suite.Equal(http.StatusNotFound, suite.pedir(http.MethodGet, "grupos/"+suite.id+"/otra", true).Code)
+	suite.Equal(http.StatusNotFound, suite.pedir(http.MethodGet, "participantes", true).Code)
+}
+
+func (suite *APITestSuite) TestSoloAceptaElMetodoDeCadaRuta() {
+	respuesta := suite.pedir(http.MethodPost, "grupos", true)
+	suite.Equal(http.StatusMethodNotAllowed, respuesta.Code)
+	suite.Equal(http.MethodGet, respuesta.Header().Get("Allow"))
+
+	respuesta = suite.pedir(http.MethodGet, "grupos/"+suite.id+"/sorteo", true)
+	suite.Equal(http.StatusMethodNotAllowed, respuesta.Code)
+	suite.Equal(http.MethodPost, respuesta.Header().Get("Allow"))
+	suite.Empty(suite.notificador.anunciados, "No debería haber sorteado")
+}
+
+func (suite *APITestSuite) TestSorteaYAvisaPorTelegram() {
+	respuesta := suite.pedir(http.MethodPost, "grupos/"+suite.id+"/sorteo", true)
+	suite.Equal(http.StatusAccepted, respuesta.Code)
+
+	detalle := api.DetalleDeGrupo{}
+	suite.leer(respuesta, &detalle)
+	suite.Equal(api.EstadoSorteado, detalle.Estado)
+	suite.Require().Len(suite.notificador.anunciados, 1, "Debería avisar del sorteo")
+	suite.Equal(suite.grupo, suite.notificador.anunciados[0].Identificador)
+
+	registro, err := suite.maga.Registro(suite.grupo, "", IDOrganizador)
+	suite.NoError(err)
+	suite.Equal(modelo.EventoSorteado, registro[len(registro)-1].Tipo, "Debería quedar el sorteo en el registro")
+}
+
+func (suite *APITestSuite) TestNoSorteaDosVeces() {
+	_, err := suite.maga.Sortear(suite.grupo, "", IDOrganizador)
+	suite.NoError(err)
+
+	respuesta := suite.pedir(http.MethodPost, "grupos/"+suite.id+"/sorteo", true)
+	suite.Equal(http.StatusConflict, respuesta.Code)
+	fallo := api.Error{}
+	suite.leer(respuesta, &fallo)
+	suite.Equal("yaSorteado", fallo.Error)
+	suite.Empty(suite.notificador.anunciados, "No debería avisar nada")
+}
+
+func (suite *APITestSuite) TestVuelveAMandarLosAmigxs() {
+	respuesta := suite.pedir(http.MethodPost, "grupos/"+suite.id+"/notificaciones", true)
+	suite.Equal(http.StatusConflict, respuesta.Code, "No debería notificar sin sortear")
+
+	_, err := suite.maga.Sortear(suite.grupo, "", IDOrganizador)
+	suite.NoError(err)
+
+	respuesta = suite.pedir(http.MethodPost, "grupos/"+suite.id+"/notificaciones", true)
+	suite.Equal(http.StatusAccepted, respuesta.Code)
+	notificaciones := api.Notificaciones{}
+	suite.leer(respuesta, &notificaciones)
+	suite.Equal(3, notificaciones.Notificaciones)
+	suite.Len(suite.notificador.mandados, 1, "Debería mandar los amigxs")
+}
+
+func (suite *APITestSuite) TestNoTocaLosJuegosTerminados() {
+	_, err := suite.maga.Sortear(suite.grupo, "", IDOrganizador)
+	suite.NoError(err)
+	suite.NoError(suite.maga.Archivar(suite.grupo, "", IDOrganizador))
+
+	respuesta := suite.pedir(http.MethodGet, "grupos/"+suite.id, true)
+	suite.Equal(http.StatusOK, respuesta.Code, "Debería mostrar los juegos terminados")
+	detalle := api.DetalleDeGrupo{}
+	suite.leer(respuesta, &detalle)
+	suite.Equal(api.EstadoTerminado, detalle.Estado)
+
+	respuesta = suite.pedir(http.MethodPost, "grupos/"+suite.id+"/notificaciones", true)
+	suite.Equal(http.StatusConflict, respuesta.Code)
+	fallo := api.Error{}
+	suite.leer(respuesta, &fallo)
+	suite.Equal("juegoTerminado", fallo.Error)
+}
+
+func (suite *APITestSuite) TestNoEsperaAQueSalganLosMensajes() {
+	enviador := &enviadorTrabado{soltar: make(chan struct{})}
+	cola := telegram.NewCola(enviador, telegram.Limites{})
+	suite.api = api.NewAPI(suite.maga, token, telegram.NewNotificador(cola, suite.maga), bitacora.Descartar())
+
+	respondio := make(chan int)
+	go func() {
+		respondio <- suite.pedir(http.MethodPost, "grupos/"+suite.id+"/sorteo", true).Code
+	}()
+	select {
+	case codigo := <-respondio:
+		suite.Equal(http.StatusAccepted, codigo)
+	case <-time.After(5 * time.Second):
+		close(enviador.soltar)
+		suite.FailNow("Debería responder sin esperar a Telegram")
+	}
+
+	ctx, cancelar := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelar()
+	suite.Error(cola.Vaciar(ctx), "Los mensajes deberían seguir pendientes")
+
+	close(enviador.soltar)
+	ctx, cancelar = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelar()
+	suite.NoError(cola.Vaciar(ctx), "Al cerrar debería esperar a que salgan los mensajes")
+}
+
+func TestAPITestSuite(t *testing.T) {
+	suite.Run(t, new(APITestSuite))
+}
@@ -0,0 +1,132 @@
+package bitacora
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Nivel int
+
+const (
+	Depuracion Nivel = iota
+	Informacion
+	Advertencia
+	Error
+)
+
+var nombresDeNiveles = []string{"debug", "info", "warn", "error"}
+
+func (n Nivel) String() string {
+	return nombresDeNiveles[n]
+}
+
+func LeerNivel(nombre string) (Nivel, error) {
+	for nivel, nombreDelNivel := range nombresDeNiveles {
+		if strings.EqualFold(nombre, nombreDelNivel) {
+			return Nivel(nivel), nil
+		}
+	}
+	return Informacion, errors.New("nivelInvalido")
+}
+
+type campo struct {
+	clave string
+	valor interface{}
+}
+
+// Escribe una línea de JSON por evento. Con Con se arma una bitácora hija que
+// agrega campos a todas sus líneas, por ejemplo el chat y el comando que se
+// está atendiendo
+type Bitacora struct {
+	salida         io.Writer
+	mutex          *sync.Mutex
+	nivel          Nivel
+	ocultarNombres bool
+	campos         []campo
+	reloj          func() time.Time
+}
+
+func New(salida io.Writer, nivel Nivel, ocultarNombres bool) *Bitacora {
+	return &Bitacora{salida: salida, mutex: &sync.Mutex{}, nivel: nivel, ocultarNombres: ocultarNombres, reloj: time.Now}
+}
+
+func Descartar() *Bitacora {
+	return New(io.Discard, Error+1, true)
+}
+
+func (b *Bitacora) Con(clave string, valor interface{}) *Bitacora {
+	hija := *b
+	hija.campos = make([]campo, len(b.campos), len(b.campos)+1)
+	copy(hija.campos, b.campos)
+	hija.campos = append(hija.campos, campo{clave: clave, valor: valor})
+	return &hija
+}
+
+// Los nombres de las personas se pueden ocultar. En su lugar queda un hash
+// corto, así se pueden seguir las líneas de una misma persona sin saber quién es
+func (b *Bitacora) ConNombre(clave string, nombre string) *Bitacora {
+	if !b.ocultarNombres {
+		return b.Con(clave, nombre)
+	}
+	hash := sha256.Sum256([]byte(nombre))
+	return b.Con(clave, "oculto:"+hex.EncodeToString(hash[:4]))
+}
+
+func (b *Bitacora) Depurar(mensaje string) {
+	b.escribir(Depuracion, mensaje, nil)
+}
+
+func (b *Bitacora) Informar(mensaje string) {
+	b.escribir(Informacion, mensaje, nil)
+}
+
+func (b *Bitacora) Advertir(mensaje string, err error) {
+	b.escribir(Advertencia, mensaje, err)
+}
+
+func (b *Bitacora) Error(mensaje string, err error) {
+	b.escribir(Error, mensaje, err)
+}
+
+func (b *Bitacora) escribir(nivel Nivel, mensaje string, err error) {
+	if nivel < b.nivel {
+		return
+	}
+
+	linea := &strings.Builder{}
+	linea.WriteString("{")
+	escribirCampo(linea, "hora", b.reloj().UTC().Format(time.RFC3339Nano), true)
+	escribirCampo(linea, "nivel", nivel.String(), false)
+	escribirCampo(linea, "mensaje", mensaje, false)
+	if err != nil {
+		escribirCampo(linea, "error", err.Error(), false)
+	}
+	for _, campo := range b.campos {
+		escribirCampo(linea, campo.clave, campo.valor, false)
+	}
+	linea.WriteString("}\n")
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	io.WriteString(b.salida, linea.String())
+}
+
+func escribirCampo(linea *strings.Builder, clave string, valor interface{}, primero bool) {
+	if !primero {
+		linea.WriteString(",")
+	}
+	claveJSON, _ := json.Marshal(clave)
+	valorJSON, err := json.Marshal(valor)
+	if err != nil {
+		valorJSON, _ = json.Marshal(err.Error())
+	}
+	linea.Write(claveJSON)
+	linea.WriteString(":")
+	linea.Write(valorJSON)
+}
@@ -0,0 +1,85 @@
+package bitacora_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/stretchr/testify/assert"
+)
+
+func lineas(t *testing.T, salida *bytes.Buffer) []map[string]interface{} {
+	eventos := make([]map[string]interface{}, 0)
+	for _, linea := range strings.Split(strings.TrimSpace(salida.String()), "\n") {
+		if linea == "" {
+			continue
+		}
+		evento := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal([]byte(linea), &evento), "Cada línea debería ser JSON")
+		eventos = append(eventos, evento)
+	}
+	return eventos
+}
+
+func TestLaBitacoraEscribeUnaLineaDeJSONPorEvento(t *testing.T) {
+	salida := &bytes.Buffer{}
+	registro := bitacora.New(salida, bitacora.Informacion, false).Con("chat", -1234).Con("comando", "/sortear")
+
+	registro.Error("Error al sortear", errors.New("sorteoImposible"))
+
+	eventos := lineas(t, salida)
+	assert.Len(t, eventos, 1, "Debería haber una línea")
+	assert.Equal(t, "error", eventos[0]["nivel"], "Debería tener el nivel")
+	assert.Equal(t, "Error al sortear", eventos[0]["mensaje"], "Debería tener el mensaje")
+	assert.Equal(t, "sorteoImposible", eventos[0]["error"], "Debería tener el error")
+	assert.Equal(t, float64(-1234), eventos[0]["chat"], "Debería tener el chat")
+	assert.Equal(t, "/sortear", eventos[0]["comando"], "Debería tener el comando")
+	assert.NotEmpty(t, eventos[0]["hora"], "Debería tener la hora")
+}
+
+func TestLaBitacoraRespetaElNivel(t *testing.T) {
+	salida := &bytes.Buffer{}
+	registro := bitacora.New(salida, bitacora.Advertencia, false)
+
+	registro.Depurar("No")
+	registro.Informar("Tampoco")
+	registro.Advertir("Sí", nil)
+
+	eventos := lineas(t, salida)
+	assert.Len(t, eventos, 1, "Sólo debería escribir lo que llega al nivel")
+	assert.Equal(t, "warn", eventos[0]["nivel"], "Debería ser la advertencia")
+}
+
+func TestLaBitacoraHijaNoCambiaALaMadre(t *testing.T) {
+	salida := &bytes.Buffer{}
+	madre := bitacora.New(salida, bitacora.Informacion, false).Con("chat", 1)
+	madre.Con("comando", "/sumame")
+
+	madre.Informar("Hola")
+
+	assert.NotContains(t, lineas(t, salida)[0], "comando", "La madre no debería tener los campos de la hija")
+}
+
+func TestLaBitacoraPuedeOcultarLosNombres(t *testing.T) {
+	salida := &bytes.Buffer{}
+	bitacora.New(salida, bitacora.Informacion, true).ConNombre("nombre", "Nay").Informar("Hola")
+	bitacora.New(salida, bitacora.Informacion, true).ConNombre("nombre", "Nay").Informar("Chau")
+	bitacora.New(salida, bitacora.Informacion, false).ConNombre("nombre", "Nay").Informar("Hola")
+
+	eventos := lineas(t, salida)
+	assert.NotContains(t, eventos[0]["nombre"], "Nay", "No debería verse el nombre")
+	assert.Equal(t, eventos[0]["nombre"], eventos[1]["nombre"], "El mismo nombre debería ocultarse igual")
+	assert.Equal(t, "Nay", eventos[2]["nombre"], "Sin ocultar debería verse el nombre")
+}
+
+func TestSeLeenLosNiveles(t *testing.T) {
+	nivel, err := bitacora.LeerNivel("WARN")
+	assert.NoError(t, err, "Debería leer el nivel")
+	assert.Equal(t, bitacora.Advertencia, nivel, "Debería ser advertencia")
+
+	_, err = bitacora.LeerNivel("gritar")
+	assert.EqualError(t, err, "nivelInvalido", "No debería leer niveles desconocidos")
+}
@@ -0,0 +1,116 @@
+package cifrado
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const prefijo = "cifrado:v1:"
+
+// Un cifrador tiene una clave actual con la que cifra y puede tener claves
+// viejas que sólo usa para descifrar lo que todavía no se volvió a cifrar
+type Cifrador struct {
+	actual string
+	claves map[string]cipher.AEAD
+}
+
+// Las claves van separadas por comas o renglones, cada una como
+// identificador:clave en base64 de 32 bytes. La primera es la actual
+func NewCifrador(claves string) (*Cifrador, error) {
+	cifrador := Cifrador{claves: make(map[string]cipher.AEAD)}
+
+	for _, clave := range strings.FieldsFunc(claves, func(r rune) bool { return r == ',' || r == '\n' }) {
+		clave = strings.TrimSpace(clave)
+		if len(clave) == 0 || strings.HasPrefix(clave, "#") {
+			continue
+		}
+
+		partes := strings.SplitN(clave, ":", 2)
+		if len(partes) != 2 || len(partes[0]) == 0 {
+			return nil, errors.New("claveInvalida")
+		}
+		identificador := partes[0]
+		if _, existe := cifrador.claves[identificador]; existe {
+			return nil, errors.New("claveRepetida")
+		}
+
+		bytes, err := base64.StdEncoding.DecodeString(partes[1])
+		if err != nil || len(bytes) != 32 {
+			return nil, errors.New("claveInvalida")
+		}
+		bloque, err := aes.NewCipher(bytes)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(bloque)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(cifrador.actual) == 0 {
+			cifrador.actual = identificador
+		}
+		cifrador.claves[identificador] = aead
+	}
+
+	if len(cifrador.actual) == 0 {
+		return nil, errors.New("sinClaves")
+	}
+	return &cifrador, nil
+}
+
+func NuevaClave() (string, error) {
+	clave := make([]byte, 32)
+	_, err := rand.Read(clave)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(clave), nil
+}
+
+// El contexto no se cifra pero se necesita el mismo para descifrar, así no se
+// puede mover un valor cifrado a otro lugar
+func (c *Cifrador) Cifrar(texto []byte, contexto string) (string, error) {
+	aead := c.claves[c.actual]
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	cifrado := aead.Seal(nonce, nonce, texto, []byte(contexto))
+	return prefijo + c.actual + ":" + base64.StdEncoding.EncodeToString(cifrado), nil
+}
+
+func (c *Cifrador) Descifrar(valor string, contexto string) ([]byte, error) {
+	if !EstaCifrado(valor) {
+		return nil, errors.New("noEstaCifrado")
+	}
+
+	partes := strings.SplitN(strings.TrimPrefix(valor, prefijo), ":", 2)
+	if len(partes) != 2 {
+		return nil, errors.New("cifradoInvalido")
+	}
+	aead, existe := c.claves[partes[0]]
+	if !existe {
+		return nil, errors.New("claveDesconocida")
+	}
+
+	cifrado, err := base64.StdEncoding.DecodeString(partes[1])
+	if err != nil || len(cifrado) < aead.NonceSize() {
+		return nil, errors.New("cifradoInvalido")
+	}
+	return aead.Open(nil, cifrado[:aead.NonceSize()], cifrado[aead.NonceSize():], []byte(contexto))
+}
+
+func (c *Cifrador) ConClaveActual(valor string) bool {
+	return strings.HasPrefix(valor, prefijo+c.actual+":")
+}
+
+func EstaCifrado(valor string) bool {
+	return strings.HasPrefix(valor, prefijo)
+}
@@ -0,0 +1,79 @@
+package cifrado_test
+
+import (
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/cifrado"
+	"github.com/stretchr/testify/assert"
+)
+
+func claves(t *testing.T, identificadores ...string) string {
+	texto := ""
+	for _, identificador := range identificadores {
+		clave, err := cifrado.NuevaClave()
+		assert.NoError(t, err, "No debería fallar al crear una clave")
+		texto += identificador + ":" + clave + ","
+	}
+	return texto
+}
+
+func TestSePuedeCifrarYDescifrar(t *testing.T) {
+	cifrador, err := cifrado.NewCifrador(claves(t, "1"))
+	assert.NoError(t, err, "No debería fallar al crear el cifrador")
+
+	cifrado1, err := cifrador.Cifrar([]byte("Nay"), "regalo:1")
+	assert.NoError(t, err, "No debería fallar al cifrar")
+	assert.NotContains(t, cifrado1, "Nay", "No debería verse el texto")
+	cifrado2, _ := cifrador.Cifrar([]byte("Nay"), "regalo:1")
+	assert.NotEqual(t, cifrado1, cifrado2, "Cifrar dos veces lo mismo debería dar distinto")
+
+	texto, err := cifrador.Descifrar(cifrado1, "regalo:1")
+	assert.NoError(t, err, "No debería fallar al descifrar")
+	assert.Equal(t, "Nay", string(texto), "Debería descifrar el texto original")
+}
+
+func TestNoSeDescifraConOtroContexto(t *testing.T) {
+	cifrador, _ := cifrado.NewCifrador(claves(t, "1"))
+	valor, _ := cifrador.Cifrar([]byte("Nay"), "regalo:1")
+
+	_, err := cifrador.Descifrar(valor, "regalo:2")
+
+	assert.Error(t, err, "No debería descifrar en otro contexto")
+}
+
+func TestSeDescifraConClavesViejas(t *testing.T) {
+	clavesViejas := claves(t, "1")
+	viejo, _ := cifrado.NewCifrador(clavesViejas)
+	valor, _ := viejo.Cifrar([]byte("Nay"), "regalo:1")
+
+	nuevo, err := cifrado.NewCifrador(claves(t, "2") + clavesViejas)
+	assert.NoError(t, err, "No debería fallar al crear el cifrador")
+
+	texto, err := nuevo.Descifrar(valor, "regalo:1")
+	assert.NoError(t, err, "Debería descifrar con la clave vieja")
+	assert.Equal(t, "Nay", string(texto), "Debería descifrar el texto original")
+	assert.False(t, nuevo.ConClaveActual(valor), "No está cifrado con la clave actual")
+	recifrado, _ := nuevo.Cifrar(texto, "regalo:1")
+	assert.True(t, nuevo.ConClaveActual(recifrado), "Debería cifrar con la clave actual")
+}
+
+func TestNoSeDescifraSinLaClave(t *testing.T) {
+	unCifrador, _ := cifrado.NewCifrador(claves(t, "1"))
+	otroCifrador, _ := cifrado.NewCifrador(claves(t, "2"))
+	valor, _ := unCifrador.Cifrar([]byte("Nay"), "regalo:1")
+
+	_, err := otroCifrador.Descifrar(valor, "regalo:1")
+
+	assert.EqualError(t, err, "claveDesconocida", "No debería descifrar sin la clave")
+}
+
+func TestLasClavesTienenQueSerValidas(t *testing.T) {
+	_, err := cifrado.NewCifrador("")
+	assert.EqualError(t, err, "sinClaves", "Debería fallar sin claves")
+
+	_, err = cifrado.NewCifrador("1:corta")
+	assert.EqualError(t, err, "claveInvalida", "Debería fallar con una clave inválida")
+
+	_, err = cifrado.NewCifrador(claves(t, "1", "1"))
+	assert.EqualError(t, err, "claveRepetida", "Debería fallar con claves repetidas")
+}
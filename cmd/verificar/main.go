@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/nickrisaro/invisible-bot/sorteo"
+)
+
+// Verifica un sorteo con el acta que manda La Maga al revelar y el compromiso
+// que publicó en el grupo al sortear:
+//
+//	go run ./cmd/verificar -compromiso <hash> sorteo.json
+func main() {
+	compromiso := flag.String("compromiso", "", "El compromiso que La Maga publicó en el grupo al sortear")
+	flag.Parse()
+
+	if flag.NArg() != 1 || len(*compromiso) == 0 {
+		fmt.Println("Uso: verificar -compromiso <hash> sorteo.json")
+		os.Exit(2)
+	}
+
+	contenido, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Println("No pude leer el acta:", err)
+		os.Exit(2)
+	}
+
+	if sorteo.Compromiso(contenido) != *compromiso {
+		fmt.Println("El acta no coincide con el compromiso, la cambiaron después del sorteo")
+		os.Exit(1)
+	}
+
+	acta, err := sorteo.LeerActa(contenido)
+	if err != nil {
+		fmt.Println("No pude leer el acta:", err)
+		os.Exit(2)
+	}
+
+	err = acta.Verificar()
+	if err != nil {
+		fmt.Println("El sorteo no sale de la semilla del acta:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("El sorteo es válido, sale de la semilla y no se cambió después de sortear")
+	for de, asignadas := range acta.Asignaciones {
+		for _, para := range asignadas {
+			fmt.Println(" *", acta.Participantes[de].Nombre, "le regala a", acta.Participantes[para].Nombre)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ModoWebhook = "webhook"
+	ModoPolling = "polling"
+)
+
+var IdiomasSoportados = []string{"es"}
+
+const (
+	LargoMinimoDelTokenDeLaAPI       = 32
+	LargoMinimoDeLaClaveDeLosEnlaces = 32
+	LargoMinimoDelTokenDeLasMetricas = 32
+)
+
+var formatoDelToken = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+
+type Config struct {
+	Host                      string
+	Puerto                    int
+	Token                     string
+	URLPublica                string
+	URLBaseDeDatos            string
+	ClavesDeCifrado           string
+	ArchivoDeClaves           string
+	Modo                      string
+	IntervaloDePolling        time.Duration
+	MensajesPorSegundo        int
+	MensajesPorSegundoPrivado int
+	MensajesPorMinutoEnGrupos int
+	Idioma                    string
+	Administradores           []int
+	NivelDeLog                string
+	OcultarNombres            bool
+	TokenDeLaAPI              string
+	TokenDeLasMetricas        string
+	ClaveDeLosEnlaces         string
+	VigenciaDeLosEnlaces      time.Duration
+}
+
+// Cada opción se puede definir en el archivo de configuración, con una
+// variable de entorno o con un flag, en ese orden de menor a mayor prioridad
+type opcion struct {
+	nombre      string
+	variable    string
+	descripcion string
+}
+
+var opciones = []opcion{
+	{"host", "HOST", "Dirección en la que escucha el webhook"},
+	{"puerto", "PORT", "Puerto en el que escucha el webhook"},
+	{"token", "TELEGRAM_API_TOKEN", "Token del bot que da BotFather"},
+	{"url-publica", "APP_URL", "URL pública a la que Telegram manda las actualizaciones"},
+	{"base-de-datos", "DATABASE_URL", "URL de la base de datos Postgres"},
+	{"claves-de-cifrado", "CLAVES_DE_CIFRADO", "Claves para cifrar los regalos, la primera es la actual"},
+	{"archivo-de-claves", "ARCHIVO_DE_CLAVES", "Archivo con las claves para cifrar los regalos"},
+	{"modo", "MODO", "Cómo recibir actualizaciones: webhook o polling"},
+	{"intervalo-de-polling", "INTERVALO_DE_POLLING", "Cuánto espera cada pedido de actualizaciones en modo polling"},
+	{"mensajes-por-segundo", "MENSAJES_POR_SEGUNDO", "Cuántos mensajes manda por segundo en total"},
+	{"mensajes-por-segundo-privado", "MENSAJES_POR_SEGUNDO_PRIVADO", "Cuántos mensajes manda por segundo a cada chat privado"},
+	{"mensajes-por-minuto-en-grupos", "MENSAJES_POR_MINUTO_EN_GRUPOS", "Cuántos mensajes manda por minuto a cada grupo"},
+	{"idioma", "IDIOMA", "Idioma por defecto de los mensajes"},
+	{"administradores", "ADMINISTRADORES", "Identificadores de Telegram de quienes administran el bot, separados por comas"},
+	{"nivel-de-log", "NIVEL_DE_LOG", "Desde qué nivel se escribe en el log: debug, info, warn o error"},
+	{"ocultar-nombres", "OCULTAR_NOMBRES", "Si se ocultan los nombres de las personas en el log"},
+	{"token-de-la-api", "API_TOKEN", "Token para usar la API HTTP, sin token la API no se publica"},
+	{"token-de-las-metricas", "METRICS_TOKEN", "Token para leer /metrics, sin token las métricas no se publican"},
+	{"clave-de-los-enlaces", "CLAVE_DE_LOS_ENLACES", "Clave para firmar los enlaces a la página de amigxs, sin clave /misamigxs no manda enlace"},
+	{"vigencia-de-los-enlaces", "VIGENCIA_DE_LOS_ENLACES", "Cuánto dura un enlace a la página de amigxs"},
+}
+
+func Uso() string {
+	uso := "Uso: invisible-bot [-config archivo.yaml] [-opcion valor ...]\n\nOpciones:\n"
+	for _, opcion := range opciones {
+		uso += fmt.Sprintf("  -%s (%s)\n    \t%s\n", opcion.nombre, opcion.variable, opcion.descripcion)
+	}
+	return uso
+}
+
+func porDefecto() *Config {
+	return &Config{
+		Host:                      "0.0.0.0",
+		Puerto:                    3000,
+		Modo:                      ModoWebhook,
+		IntervaloDePolling:        10 * time.Second,
+		MensajesPorSegundo:        30,
+		MensajesPorSegundoPrivado: 1,
+		MensajesPorMinutoEnGrupos: 20,
+		Idioma:                    "es",
+		Administradores:           make([]int, 0),
+		NivelDeLog:                "info",
+		VigenciaDeLosEnlaces:      24 * time.Hour,
+	}
+}
+
+// Carga la configuración de los valores por defecto, el archivo que se indique
+// con -config o ARCHIVO_DE_CONFIGURACION, las variables de entorno y los flags
+func Cargar(argumentos []string, variable func(string) string) (*Config, error) {
+	flags := flag.NewFlagSet("invisible-bot", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	archivo := flags.String("config", variable("ARCHIVO_DE_CONFIGURACION"), "Archivo de configuración en YAML")
+	valoresDeFlags := make(map[string]*string, len(opciones))
+	for _, opcion := range opciones {
+		valoresDeFlags[opcion.nombre] = flags.String(opcion.nombre, "", opcion.descripcion+" ("+opcion.variable+")")
+	}
+	err := flags.Parse(argumentos)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, errors.New("argumentoDesconocido: " + flags.Arg(0))
+	}
+
+	configuracion := porDefecto()
+
+	if *archivo != "" {
+		contenido, err := os.ReadFile(*archivo)
+		if err != nil {
+			return nil, err
+		}
+		err = configuracion.leerArchivo(contenido)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, opcion := range opciones {
+		valor := variable(opcion.variable)
+		if valor == "" {
+			continue
+		}
+		err := configuracion.asignar(opcion.nombre, valor)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opcion.variable, err)
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		err = configuracion.asignar(f.Name, *valoresDeFlags[f.Name])
+		if err != nil {
+			err = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = configuracion.Validar()
+	if err != nil {
+		return nil, err
+	}
+	return configuracion, nil
+}
+
+// Las claves del archivo son los nombres de los flags
+func (c *Config) leerArchivo(contenido []byte) error {
+	valores := make(map[string]interface{})
+	err := yaml.Unmarshal(contenido, &valores)
+	if err != nil {
+		return err
+	}
+
+	for nombre, valor := range valores {
+		texto := fmt.Sprint(valor)
+		if lista, esLista := valor.([]interface{}); esLista {
+			elementos := make([]string, len(lista))
+			for i, elemento := range lista {
+				elementos[i] = fmt.Sprint(elemento)
+			}
+			texto = strings.Join(elementos, ",")
+		}
+
+		err := c.asignar(nombre, texto)
+		if err != nil {
+			return fmt.Errorf("%s: %w", nombre, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) asignar(nombre string, valor string) error {
+	var err error
+	switch nombre {
+	case "host":
+		c.Host = valor
+	case "puerto":
+		c.Puerto, err = strconv.Atoi(valor)
+	case "token":
+		c.Token = valor
+	case "url-publica":
+		c.URLPublica = valor
+	case "base-de-datos":
+		c.URLBaseDeDatos = valor
+	case "claves-de-cifrado":
+		c.ClavesDeCifrado = valor
+	case "archivo-de-claves":
+		c.ArchivoDeClaves = valor
+	case "modo":
+		c.Modo = strings.ToLower(valor)
+	case "intervalo-de-polling":
+		c.IntervaloDePolling, err = time.ParseDuration(valor)
+	case "mensajes-por-segundo":
+		c.MensajesPorSegundo, err = strconv.Atoi(valor)
+	case "mensajes-por-segundo-privado":
+		c.MensajesPorSegundoPrivado, err = strconv.Atoi(valor)
+	case "mensajes-por-minuto-en-grupos":
+		c.MensajesPorMinutoEnGrupos, err = strconv.Atoi(valor)
+	case "idioma":
+		c.Idioma = strings.ToLower(valor)
+	case "administradores":
+		c.Administradores, err = leerIdentificadores(valor)
+	case "nivel-de-log":
+		c.NivelDeLog = strings.ToLower(valor)
+	case "ocultar-nombres":
+		c.OcultarNombres, err = strconv.ParseBool(valor)
+	case "token-de-la-api":
+		c.TokenDeLaAPI = valor
+	case "token-de-las-metricas":
+		c.TokenDeLasMetricas = valor
+	case "clave-de-los-enlaces":
+		c.ClaveDeLosEnlaces = valor
+	case "vigencia-de-los-enlaces":
+		c.VigenciaDeLosEnlaces, err = time.ParseDuration(valor)
+	default:
+		return errors.New("opcionDesconocida")
+	}
+	if err != nil {
+		return errors.New("valorInvalido")
+	}
+	return nil
+}
+
+func leerIdentificadores(valor string) ([]int, error) {
+	identificadores := make([]int, 0)
+	for _, texto := range strings.Split(valor, ",") {
+		texto = strings.TrimSpace(texto)
+		if texto == "" {
+			continue
+		}
+		identificador, err := strconv.Atoi(texto)
+		if err != nil {
+			return nil, err
+		}
+		identificadores = append(identificadores, identificador)
+	}
+	return identificadores, nil
+}
+
+// Revisa todos los valores y si hay problemas los devuelve juntos, así se
+// pueden corregir de una vez
+func (c *Config) Validar() error {
+	problemas := make([]string, 0)
+
+	if !formatoDelToken.MatchString(c.Token) {
+		problemas = append(problemas, "token")
+	}
+	if c.URLBaseDeDatos == "" || !tieneEsquema(c.URLBaseDeDatos, "postgres", "postgresql") {
+		problemas = append(problemas, "base-de-datos")
+	}
+	if c.ClavesDeCifrado != "" && c.ArchivoDeClaves != "" {
+		problemas = append(problemas, "claves-de-cifrado")
+	}
+
+	switch c.Modo {
+	case ModoWebhook:
+		if c.Puerto < 1 || c.Puerto > 65535 {
+			problemas = append(problemas, "puerto")
+		}
+		if !tieneEsquema(c.URLPublica, "https") {
+			problemas = append(problemas, "url-publica")
+		}
+	case ModoPolling:
+		if c.IntervaloDePolling <= 0 {
+			problemas = append(problemas, "intervalo-de-polling")
+		}
+	default:
+		problemas = append(problemas, "modo")
+	}
+
+	if c.MensajesPorSegundo < 1 {
+		problemas = append(problemas, "mensajes-por-segundo")
+	}
+	if c.MensajesPorSegundoPrivado < 1 {
+		problemas = append(problemas, "mensajes-por-segundo-privado")
+	}
+	if c.MensajesPorMinutoEnGrupos < 1 {
+		problemas = append(problemas, "mensajes-por-minuto-en-grupos")
+	}
+
+	idiomaSoportado := false
+	for _, idioma := range IdiomasSoportados {
+		idiomaSoportado = idiomaSoportado || c.Idioma == idioma
+	}
+	if !idiomaSoportado {
+		problemas = append(problemas, "idioma")
+	}
+
+	if c.TokenDeLaAPI != "" && len(c.TokenDeLaAPI) < LargoMinimoDelTokenDeLaAPI {
+		problemas = append(problemas, "token-de-la-api")
+	}
+	if c.TokenDeLasMetricas != "" && len(c.TokenDeLasMetricas) < LargoMinimoDelTokenDeLasMetricas {
+		problemas = append(problemas, "token-de-las-metricas")
+	}
+	if c.ClaveDeLosEnlaces != "" {
+		if len(c.ClaveDeLosEnlaces) < LargoMinimoDeLaClaveDeLosEnlaces {
+			problemas = append(problemas, "clave-de-los-enlaces")
+		}
+		// Los enlaces apuntan a la URL pública, en modo webhook ya se revisó arriba
+		if c.Modo == ModoPolling && !tieneEsquema(c.URLPublica, "http", "https") {
+			problemas = append(problemas, "url-publica")
+		}
+	}
+	if c.VigenciaDeLosEnlaces < time.Hour {
+		problemas = append(problemas, "vigencia-de-los-enlaces")
+	}
+
+	for _, administrador := range c.Administradores {
+		if administrador <= 0 {
+			problemas = append(problemas, "administradores")
+			break
+		}
+	}
+
+	if _, err := bitacora.LeerNivel(c.NivelDeLog); err != nil {
+		problemas = append(problemas, "nivel-de-log")
+	}
+
+	if len(problemas) > 0 {
+		return errors.New("configuracionInvalida: " + strings.Join(problemas, ", "))
+	}
+	return nil
+}
+
+func (c *Config) Bitacora(salida io.Writer) *bitacora.Bitacora {
+	nivel, _ := bitacora.LeerNivel(c.NivelDeLog)
+	return bitacora.New(salida, nivel, c.OcultarNombres)
+}
+
+func (c *Config) DireccionPrivada() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Puerto)
+}
+
+func (c *Config) EsAdministrador(identificador int) bool {
+	for _, administrador := range c.Administradores {
+		if administrador == identificador {
+			return true
+		}
+	}
+	return false
+}
+
+// Lee las claves de cifrado del archivo si se indicó uno
+func (c *Config) Claves() (string, error) {
+	if c.ArchivoDeClaves == "" {
+		return c.ClavesDeCifrado, nil
+	}
+	contenido, err := os.ReadFile(c.ArchivoDeClaves)
+	if err != nil {
+		return "", err
+	}
+	return string(contenido), nil
+}
+
+func tieneEsquema(direccion string, esquemas ...string) bool {
+	parseada, err := url.Parse(direccion)
+	if err != nil || parseada.Host == "" {
+		return false
+	}
+	for _, esquema := range esquemas {
+		if parseada.Scheme == esquema {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package lamaga
+
+import (
+	"errors"
+
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"gorm.io/gorm"
+)
+
+// Lo que ve quien administra La Maga de cada juego. Nunca lleva los regalos
+type ResumenDeJuego struct {
+	Grupo         *modelo.Grupo
+	Participantes int
+	SinNotificar  int
+}
+
+func (lm *LaMaga) ResumenDeJuegos() ([]ResumenDeJuego, error) {
+	grupos := make([]*modelo.Grupo, 0)
+	resultado := lm.miBaseDeDatos.Unscoped().Preload("Participantes").Order("id").Find(&grupos)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	resumenes := make([]ResumenDeJuego, 0, len(grupos))
+	for _, grupo := range grupos {
+		resumenes = append(resumenes, resumirJuego(grupo))
+	}
+	return resumenes, nil
+}
+
+func (lm *LaMaga) ResumenDelJuego(id uint) (*ResumenDeJuego, error) {
+	grupo, err := lm.juegoPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	resumen := resumirJuego(grupo)
+	return &resumen, nil
+}
+
+// Muestra a quién le regala cada une, así que queda en la bitácora quién lo pidió
+func (lm *LaMaga) AmigxsDelJuego(id uint, administrador int) ([]*modelo.Participante, error) {
+	grupo, err := lm.juegoPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !grupo.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	err = lm.cargarAmigxs(lm.miBaseDeDatos, grupo.Participantes)
+	if err != nil {
+		return nil, err
+	}
+	lm.registro.Con("administrador", administrador).Con("juego", id).Advertir("Se mostraron los regalos de un juego", nil)
+	return grupo.Participantes, nil
+}
+
+func (lm *LaMaga) NotificacionesDelJuego(id uint, administrador int) ([]Notificacion, error) {
+	grupo, err := lm.juegoActivoPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !grupo.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	participantes := make([]*modelo.Participante, 0, len(grupo.Participantes))
+	for _, participante := range grupo.Participantes {
+		if !participante.SeFue {
+			participantes = append(participantes, participante)
+		}
+	}
+	notificaciones, err := lm.notificacionesPara(participantes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = anotar(lm.miBaseDeDatos, &modelo.Evento{GrupoID: grupo.ID, Tipo: modelo.EventoRenotificado, Cuenta: administrador, Detalle: "administracion"})
+	if err != nil {
+		return nil, err
+	}
+	return notificaciones, nil
+}
+
+// Las cuentas de Telegram de quienes juegan en algún juego sin terminar, sin repetir
+func (lm *LaMaga) CuentasQueJuegan() ([]int, error) {
+	participantes := make([]*modelo.Participante, 0)
+	resultado := lm.miBaseDeDatos.
+		Where("se_fue = ?", false).
+		Where("grupo_id IN (?)", lm.miBaseDeDatos.Model(&modelo.Grupo{}).Select("id")).
+		Order("id").
+		Find(&participantes)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	cuentas := make([]int, 0, len(participantes))
+	vistas := make(map[int]bool)
+	for _, participante := range participantes {
+		cuenta := participante.Destinatario()
+		if cuenta == 0 || vistas[cuenta] {
+			continue
+		}
+		vistas[cuenta] = true
+		cuentas = append(cuentas, cuenta)
+	}
+	return cuentas, nil
+}
+
+func (lm *LaMaga) juegoPorID(id uint) (*modelo.Grupo, error) {
+	grupo := modelo.Grupo{}
+	resultado := lm.miBaseDeDatos.Unscoped().Preload("Participantes").First(&grupo, id)
+	if errors.Is(resultado.Error, gorm.ErrRecordNotFound) {
+		return nil, errors.New("noExisteElJuego")
+	}
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+	grupo.Acta = ""
+	return &grupo, nil
+}
+
+func (lm *LaMaga) juegoActivoPorID(id uint) (*modelo.Grupo, error) {
+	grupo, err := lm.juegoPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	if grupo.ArchivadoEn.Valid {
+		return nil, errors.New("juegoTerminado")
+	}
+	return grupo, nil
+}
+
+func resumirJuego(grupo *modelo.Grupo) ResumenDeJuego {
+	grupo.Acta = ""
+	resumen := ResumenDeJuego{Grupo: grupo}
+	for _, participante := range grupo.Participantes {
+		if participante.SeFue {
+			continue
+		}
+		resumen.Participantes++
+		if grupo.YaSorteo && !participante.FueNotificado() {
+			resumen.SinNotificar++
+		}
+	}
+	return resumen
+}
@@ -0,0 +1,63 @@
+package lamaga
+
+import (
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"gorm.io/gorm"
+)
+
+func PrepararBaseDeDatos(baseDeDatos *gorm.DB) error {
+	err := baseDeDatos.AutoMigrate(&modelo.Grupo{}, &modelo.Participante{}, &modelo.Regalo{}, &modelo.Evento{})
+	if err != nil {
+		return err
+	}
+
+	// Antes cada chat podía tener un único juego
+	migrador := baseDeDatos.Migrator()
+	if migrador.HasConstraint(&modelo.Grupo{}, "grupos_identificador_key") {
+		err = migrador.DropConstraint(&modelo.Grupo{}, "grupos_identificador_key")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Antes los juegos archivados no ocupaban lugar porque se borraban
+	if migrador.HasIndex(&modelo.Grupo{}, "idx_grupos_juego") {
+		err = migrador.DropIndex(&modelo.Grupo{}, "idx_grupos_juego")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Antes cada participante tenía un único amigx. Se copian y se borran
+	// juntos, si no un reinicio en el medio copiaría los regalos dos veces
+	if migrador.HasColumn(&modelo.Participante{}, "amigx_id") {
+		err = baseDeDatos.Transaction(func(tx *gorm.DB) error {
+			resultado := tx.Exec("INSERT INTO regalos (de_id, para_id) SELECT id, amigx_id FROM participantes WHERE amigx_id IS NOT NULL")
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+			if tx.Migrator().HasConstraint(&modelo.Participante{}, "fk_participantes_amigx") {
+				err := tx.Migrator().DropConstraint(&modelo.Participante{}, "fk_participantes_amigx")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&modelo.Participante{}, "amigx_id")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Antes los regalos se guardaban sin poder cifrarse
+	if migrador.HasTable("asignaciones") {
+		return baseDeDatos.Transaction(func(tx *gorm.DB) error {
+			resultado := tx.Exec("INSERT INTO regalos (de_id, para_id) SELECT de_id, para_id FROM asignaciones")
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+			return tx.Migrator().DropTable("asignaciones")
+		})
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package lamaga
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"gorm.io/gorm"
+)
+
+type EventoDelJuego struct {
+	modelo.Evento
+	Quien string
+	Sobre string
+}
+
+func (lm *LaMaga) Registro(identificadorDeGrupo int64, juego string, solicitante int) ([]EventoDelJuego, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return nil, errors.New("noEsOrganizador")
+	}
+
+	eventos := make([]modelo.Evento, 0)
+	resultado := lm.miBaseDeDatos.Where("grupo_id = ?", grupoDeLaDB.ID).Order("id").Find(&eventos)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	porCuenta := make(map[int]string)
+	porID := make(map[uint]string)
+	for _, participante := range grupoDeLaDB.Participantes {
+		porID[participante.ID] = participante.Nombre
+		if participante.TieneTelegram() {
+			porCuenta[participante.Identificador] = participante.Nombre
+		}
+	}
+
+	linea := make([]EventoDelJuego, 0, len(eventos))
+	for _, evento := range eventos {
+		eventoDelJuego := EventoDelJuego{Evento: evento, Quien: porCuenta[evento.Cuenta]}
+		if evento.ParticipanteID != nil {
+			eventoDelJuego.Sobre = porID[*evento.ParticipanteID]
+		}
+		linea = append(linea, eventoDelJuego)
+	}
+	return linea, nil
+}
+
+// Hace el cambio y anota el evento en la misma transacción, así no queda
+// un cambio sin su evento. El cambio puede completar el evento, por ejemplo
+// con el ID del grupo que acaba de crear
+func (lm *LaMaga) cambiar(evento *modelo.Evento, cambio func(tx *gorm.DB) error) error {
+	return lm.miBaseDeDatos.Transaction(func(tx *gorm.DB) error {
+		err := cambio(tx)
+		if err != nil {
+			return err
+		}
+		return anotar(tx, evento)
+	})
+}
+
+func anotar(tx *gorm.DB, evento *modelo.Evento) error {
+	evento.ID = 0
+	evento.Momento = time.Now()
+	return tx.Create(evento).Error
+}
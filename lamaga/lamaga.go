@@ -3,51 +3,396 @@ package lamaga
 import (
 	"errors"
 	"math/rand"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/cifrado"
+	"github.com/nickrisaro/invisible-bot/metricas"
 	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/sorteo"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const PlazoParaRestaurar = 7 * 24 * time.Hour
+
 type LaMaga struct {
 	miBaseDeDatos *gorm.DB
+	cifrador      *cifrado.Cifrador
+	registro      *bitacora.Bitacora
 }
 
 func NewMaga(baseDeDatos *gorm.DB) *LaMaga {
-	return &LaMaga{miBaseDeDatos: baseDeDatos}
+	return &LaMaga{miBaseDeDatos: baseDeDatos, registro: bitacora.Descartar()}
+}
+
+// Con un cifrador La Maga guarda cifrado a quién le regala cada une y las
+// actas de los sorteos, así no se ven mirando la base de datos
+func NewMagaCifrada(baseDeDatos *gorm.DB, cifrador *cifrado.Cifrador) *LaMaga {
+	return &LaMaga{miBaseDeDatos: baseDeDatos, cifrador: cifrador, registro: bitacora.Descartar()}
+}
+
+func (lm *LaMaga) UsarBitacora(registro *bitacora.Bitacora) {
+	lm.registro = registro
+}
+
+// Para que lo que se loguea al atender un pedido lleve los datos del pedido.
+// Comparte la base de datos y el cifrador con la original
+func (lm *LaMaga) ConBitacora(registro *bitacora.Bitacora) *LaMaga {
+	copia := *lm
+	copia.registro = registro
+	return &copia
 }
 
-func (lm *LaMaga) NuevoGrupo(identificador int64, nombre string) error {
+func (lm *LaMaga) NuevoGrupo(identificador int64, juego string, nombre string, organizador int) error {
 	grupo := modelo.NewGrupo(identificador, nombre)
-	resultado := lm.miBaseDeDatos.Create(grupo)
-	if resultado.Error != nil && strings.Contains(resultado.Error.Error(), "UNIQUE") {
+	grupo.Juego = juego
+	grupo.Organizador = organizador
+	evento := modelo.Evento{Tipo: modelo.EventoCreado, Cuenta: organizador}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		err := hayJuegoActivo(tx, identificador, juego)
+		if err != nil {
+			return err
+		}
+		resultado := tx.Create(grupo)
+		evento.GrupoID = grupo.ID
+		return resultado.Error
+	})
+}
+
+// Los nombres de los juegos no distinguen mayúsculas, igual que al buscarlos
+func hayJuegoActivo(tx *gorm.DB, identificadorDeGrupo int64, juego string) error {
+	var activos int64
+	resultado := tx.Model(&modelo.Grupo{}).
+		Where("identificador = ? AND LOWER(juego) = LOWER(?)", identificadorDeGrupo, juego).
+		Count(&activos)
+	if resultado.Error != nil {
+		return resultado.Error
+	}
+	if activos > 0 {
 		return errors.New("ya existe ese grupo")
 	}
+	return nil
+}
+
+func (lm *LaMaga) Juego(identificadorDeGrupo int64, juego string) (*modelo.Grupo, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	grupoDeLaDB.Acta, err = lm.descifrarActa(grupoDeLaDB)
+	if err != nil {
+		return nil, err
+	}
+	return grupoDeLaDB, nil
+}
+
+func (lm *LaMaga) Juegos(identificadorDeGrupo int64) ([]*modelo.Grupo, error) {
+	grupos := make([]*modelo.Grupo, 0)
+	resultado := lm.miBaseDeDatos.Where("identificador = ?", identificadorDeGrupo).Order("id").Find(&grupos)
+	return grupos, resultado.Error
+}
+
+func (lm *LaMaga) Migrar(identificadorViejo int64, identificadorNuevo int64) error {
+	resultado := lm.miBaseDeDatos.Unscoped().Model(&modelo.Grupo{}).
+		Where("identificador = ?", identificadorViejo).
+		Update("identificador", identificadorNuevo)
+	return resultado.Error
+}
+
+func (lm *LaMaga) Renombrar(identificadorDeGrupo int64, nombre string) error {
+	resultado := lm.miBaseDeDatos.Model(&modelo.Grupo{}).
+		Where("identificador = ?", identificadorDeGrupo).
+		Update("nombre", nombre)
 	return resultado.Error
 }
 
-func (lm *LaMaga) NuevoParticipante(identificadorDeGrupo int64, identificadorDeParticipante int, nombreDeParticipante string) error {
+func (lm *LaMaga) NuevoParticipante(identificadorDeGrupo int64, juego string, identificadorDeParticipante int, nombreDeParticipante string) error {
 	participante := modelo.NewParticipante(identificadorDeParticipante, nombreDeParticipante)
 
-	grupoDeLaDB := modelo.Grupo{Identificador: identificadorDeGrupo}
-	resultado := lm.miBaseDeDatos.Where(&grupoDeLaDB).Preload("Participantes").First(&grupoDeLaDB)
-	if resultado.Error != nil {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	cantidadDeParticipantes := len(grupoDeLaDB.Participantes)
+	grupoDeLaDB.Agregar(participante)
+	if len(grupoDeLaDB.Participantes) == cantidadDeParticipantes {
+		return nil
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoSumado, Cuenta: identificadorDeParticipante}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		resultado := tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(grupoDeLaDB)
+		evento.ParticipanteID = &participante.ID
 		return resultado.Error
+	})
+}
+
+func (lm *LaMaga) NuevoParticipanteSinTelegram(identificadorDeGrupo int64, juego string, solicitante int, nombreDeParticipante string, responsable string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	identificadorDelResponsable := solicitante
+	if len(responsable) > 0 {
+		identificadorDelResponsable = 0
+		for _, participante := range grupoDeLaDB.Participantes {
+			if participante.TieneTelegram() && participante.EsQuien(responsable) {
+				identificadorDelResponsable = participante.Identificador
+				break
+			}
+		}
+		if identificadorDelResponsable == 0 {
+			return errors.New("responsableNoEncontrado")
+		}
+	}
+
+	return lm.agregarSinTelegram(grupoDeLaDB, nombreDeParticipante, identificadorDelResponsable, solicitante)
+}
+
+func (lm *LaMaga) NuevoParticipanteACargo(identificadorDeGrupo int64, juego string, cuenta int, nombreDeParticipante string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return err
 	}
 
+	return lm.agregarSinTelegram(grupoDeLaDB, nombreDeParticipante, cuenta, cuenta)
+}
+
+func (lm *LaMaga) agregarSinTelegram(grupoDeLaDB *modelo.Grupo, nombreDeParticipante string, responsable int, solicitante int) error {
+	if grupoDeLaDB.YaSorteo {
+		return errors.New("yaSorteado")
+	}
+
+	participante := modelo.NewParticipanteSinTelegram(strings.TrimSpace(nombreDeParticipante), responsable)
+	cantidadDeParticipantes := len(grupoDeLaDB.Participantes)
 	grupoDeLaDB.Agregar(participante)
+	if len(grupoDeLaDB.Participantes) == cantidadDeParticipantes {
+		return errors.New("yaParticipa")
+	}
 
-	resultado = lm.miBaseDeDatos.Session(&gorm.Session{FullSaveAssociations: true}).Save(grupoDeLaDB)
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoSumado, Cuenta: solicitante}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		resultado := tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(grupoDeLaDB)
+		evento.ParticipanteID = &participante.ID
+		return resultado.Error
+	})
+}
+
+func (lm *LaMaga) ActualizarIdentidad(identificadorDeParticipante int, usuario string, primerNombre string, apellido string) error {
+	resultado := lm.miBaseDeDatos.Model(&modelo.Participante{}).
+		Where("identificador = ?", identificadorDeParticipante).
+		Where("COALESCE(usuario, '') <> ? OR COALESCE(primer_nombre, '') <> ? OR COALESCE(apellido, '') <> ?", usuario, primerNombre, apellido).
+		Updates(map[string]interface{}{
+			"usuario":       usuario,
+			"primer_nombre": primerNombre,
+			"apellido":      apellido,
+			"nombre":        modelo.NombreCompleto(primerNombre, apellido),
+		})
 	return resultado.Error
 }
 
-func (lm *LaMaga) QuienesParticipan(identificadorDeGrupo int64) ([]string, error) {
-	grupoDeLaDB := modelo.Grupo{Identificador: identificadorDeGrupo}
-	resultado := lm.miBaseDeDatos.Where(&grupoDeLaDB).Preload("Participantes").First(&grupoDeLaDB)
+func (lm *LaMaga) SeFue(identificadorDeGrupo int64, identificadorDeParticipante int) ([]Salida, error) {
+	grupos := make([]*modelo.Grupo, 0)
+	resultado := lm.miBaseDeDatos.Where("identificador = ?", identificadorDeGrupo).Find(&grupos)
 	if resultado.Error != nil {
 		return nil, resultado.Error
 	}
 
+	salidas := make([]Salida, 0)
+	for _, grupo := range grupos {
+		participante := modelo.Participante{GrupoID: grupo.ID, Identificador: identificadorDeParticipante}
+		resultado = lm.miBaseDeDatos.Where(&participante).Limit(1).Find(&participante)
+		if resultado.Error != nil {
+			return nil, resultado.Error
+		}
+		if resultado.RowsAffected == 0 {
+			continue
+		}
+
+		evento := modelo.Evento{GrupoID: grupo.ID, Tipo: modelo.EventoSeFue, Cuenta: identificadorDeParticipante, ParticipanteID: &participante.ID}
+		err := lm.cambiar(&evento, func(tx *gorm.DB) error {
+			if grupo.YaSorteo {
+				participante.SeFue = true
+				return tx.Omit(clause.Associations).Save(&participante).Error
+			}
+			return tx.Delete(&participante).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		salidas = append(salidas, Salida{Grupo: grupo, Participante: &participante})
+	}
+
+	return salidas, nil
+}
+
+func (lm *LaMaga) Reenlazar(identificadorDeGrupo int64, juego string, solicitante int) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return nil, errors.New("noEsOrganizador")
+	}
+
+	if !grupoDeLaDB.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	err = lm.cargarAmigxs(lm.miBaseDeDatos, grupoDeLaDB.Participantes)
+	if err != nil {
+		return nil, err
+	}
+
+	participantesPorID := make(map[uint]*modelo.Participante, len(grupoDeLaDB.Participantes))
+	for _, participante := range grupoDeLaDB.Participantes {
+		participantesPorID[participante.ID] = participante
+	}
+
+	aleatorio := rand.New(rand.NewSource(time.Now().UnixNano()))
+	reenlazados := make(map[uint]*modelo.Participante)
+	seFueron := make([]*modelo.Participante, 0)
+	for _, quienSeFue := range grupoDeLaDB.Participantes {
+		if !quienSeFue.SeFue {
+			continue
+		}
+		seFueron = append(seFueron, quienSeFue)
+		delete(participantesPorID, quienSeFue.ID)
+
+		quienesLeRegalaban := make([]*modelo.Participante, 0)
+		for _, participante := range participantesPorID {
+			if participante.LeRegalaA(quienSeFue) {
+				participante.Amigxs = sinAmigx(participante.Amigxs, quienSeFue)
+				quienesLeRegalaban = append(quienesLeRegalaban, participante)
+				reenlazados[participante.ID] = participante
+			}
+		}
+		susAmigxs := make([]*modelo.Participante, 0, len(quienSeFue.Amigxs))
+		for _, amigx := range quienSeFue.Amigxs {
+			if participantesPorID[amigx.ID] != nil {
+				susAmigxs = append(susAmigxs, participantesPorID[amigx.ID])
+			}
+		}
+
+		// Quienes le regalaban pasan a regalarle a quienes recibían de quien se fue
+		puedeRegalar := func(de *modelo.Participante, a *modelo.Participante) bool {
+			return !de.LeRegalaA(a) && grupoDeLaDB.PuedeRegalar(de, a)
+		}
+		regalaA, _ := sorteo.Emparejar(aleatorio, len(quienesLeRegalaban), len(susAmigxs), func(de int, a int) bool {
+			return puedeRegalar(quienesLeRegalaban[de], susAmigxs[a])
+		})
+		sinAsignar := make([]*modelo.Participante, 0)
+		sinQuienLeRegale := make(map[int]bool, len(susAmigxs))
+		for a := range susAmigxs {
+			sinQuienLeRegale[a] = true
+		}
+		for de, a := range regalaA {
+			if a == -1 {
+				sinAsignar = append(sinAsignar, quienesLeRegalaban[de])
+				continue
+			}
+			quienesLeRegalaban[de].Amigxs = append(quienesLeRegalaban[de].Amigxs, susAmigxs[a])
+			delete(sinQuienLeRegale, a)
+		}
+
+		// Si alguien quedó sin poder regalarle a nadie (por ejemplo porque se
+		// regalaban entre sí) se mete en el medio de otro regalo
+		for _, quienQuedo := range sinAsignar {
+			var quienFalta *modelo.Participante
+			for a := range sinQuienLeRegale {
+				quienFalta = susAmigxs[a]
+				delete(sinQuienLeRegale, a)
+				break
+			}
+			if quienFalta == nil {
+				return nil, errors.New("noSePuedeReenlazar")
+			}
+
+			otro, suAmigx := buscarRegaloParaIntercalar(participantesPorID, quienQuedo, quienFalta, puedeRegalar)
+			if otro == nil {
+				return nil, errors.New("noSePuedeReenlazar")
+			}
+			otro.Amigxs = append(sinAmigx(otro.Amigxs, suAmigx), quienFalta)
+			quienQuedo.Amigxs = append(quienQuedo.Amigxs, suAmigx)
+			reenlazados[otro.ID] = otro
+		}
+	}
+
+	for _, quienSeFue := range seFueron {
+		delete(reenlazados, quienSeFue.ID)
+	}
+
+	cambios := make([]*modelo.Participante, 0, len(reenlazados))
+	errorAlGuardar := lm.miBaseDeDatos.Transaction(func(tx *gorm.DB) error {
+		for _, participante := range reenlazados {
+			participante.Notificacion = modelo.EstadoNotificacion{Estado: modelo.NotificacionPendiente}
+			err := lm.guardarAmigxs(tx, participante)
+			if err != nil {
+				return err
+			}
+			cambios = append(cambios, participante)
+		}
+		for _, quienSeFue := range seFueron {
+			resultado := tx.Where("de_id = ?", quienSeFue.ID).Delete(&modelo.Regalo{})
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+			resultado = tx.Delete(quienSeFue)
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+		}
+		return anotar(tx, &modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoReenlazado, Cuenta: solicitante, Detalle: strconv.Itoa(len(cambios))})
+	})
+	if errorAlGuardar != nil {
+		return nil, errorAlGuardar
+	}
+
+	lm.registro.Con("grupo", identificadorDeGrupo).Con("juego", juego).Con("reenlazados", len(cambios)).Con("salieron", len(seFueron)).Informar("Regalos reenlazados")
+	return cambios, nil
+}
+
+func buscarRegaloParaIntercalar(participantes map[uint]*modelo.Participante, quienQuedo *modelo.Participante, quienFalta *modelo.Participante, puedeRegalar func(*modelo.Participante, *modelo.Participante) bool) (*modelo.Participante, *modelo.Participante) {
+	for _, otro := range participantes {
+		if otro.ID == quienQuedo.ID || !puedeRegalar(otro, quienFalta) {
+			continue
+		}
+		for _, suAmigx := range otro.Amigxs {
+			if suAmigx.ID != quienFalta.ID && puedeRegalar(quienQuedo, suAmigx) {
+				return otro, suAmigx
+			}
+		}
+	}
+	return nil, nil
+}
+
+func sinAmigx(amigxs []*modelo.Participante, amigx *modelo.Participante) []*modelo.Participante {
+	quedan := make([]*modelo.Participante, 0, len(amigxs))
+	for _, otro := range amigxs {
+		if otro.ID != amigx.ID {
+			quedan = append(quedan, otro)
+		}
+	}
+	return quedan
+}
+
+func (lm *LaMaga) QuienesParticipan(identificadorDeGrupo int64, juego string) ([]string, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
 	nombresDeParticipantes := make([]string, len(grupoDeLaDB.Participantes))
 
 	for i, participante := range grupoDeLaDB.Participantes {
@@ -57,115 +402,786 @@ func (lm *LaMaga) QuienesParticipan(identificadorDeGrupo int64) ([]string, error
 	return nombresDeParticipantes, nil
 }
 
-func (lm *LaMaga) Sortear(identificadorDeGrupo int64) ([]*modelo.Participante, error) {
-	grupoDeLaDB := modelo.Grupo{Identificador: identificadorDeGrupo}
-	resultado := lm.miBaseDeDatos.Where(&grupoDeLaDB).Preload("Participantes").First(&grupoDeLaDB)
-	if resultado.Error != nil {
-		return nil, resultado.Error
+func (lm *LaMaga) Sortear(identificadorDeGrupo int64, juego string, solicitante int) ([]*modelo.Participante, error) {
+	registroDelSorteo := lm.registro.Con("grupo", identificadorDeGrupo).Con("juego", juego)
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	return lm.contarSorteo(registroDelSorteo, grupoDeLaDB, err, solicitante)
+}
+
+func (lm *LaMaga) SortearPorID(id uint, solicitante int) ([]*modelo.Participante, error) {
+	registroDelSorteo := lm.registro.Con("juego", id)
+	grupoDeLaDB, err := lm.juegoActivoPorID(id)
+	return lm.contarSorteo(registroDelSorteo, grupoDeLaDB, err, solicitante)
+}
+
+// Los sorteos se cuentan aunque no se encuentre el juego
+func (lm *LaMaga) contarSorteo(registroDelSorteo *bitacora.Bitacora, grupoDeLaDB *modelo.Grupo, err error, solicitante int) ([]*modelo.Participante, error) {
+	var sorteados []*modelo.Participante
+	if err == nil {
+		sorteados, err = lm.sortear(grupoDeLaDB, solicitante)
 	}
+	metricas.Sorteos.WithLabelValues(metricas.Resultado(err)).Inc()
+	if err != nil {
+		registroDelSorteo.Advertir("No se pudo sortear", err)
+	} else {
+		registroDelSorteo.Con("participantes", len(sorteados)).Informar("Sorteo hecho")
+	}
+	return sorteados, err
+}
 
+func (lm *LaMaga) sortear(grupoDeLaDB *modelo.Grupo, solicitante int) ([]*modelo.Participante, error) {
 	if grupoDeLaDB.YaSorteo {
 		return nil, errors.New("yaSorteado")
 	}
 
 	cantidadDeParticipantes := len(grupoDeLaDB.Participantes)
 
-	if cantidadDeParticipantes < 2 {
+	if cantidadDeParticipantes < 2 || cantidadDeParticipantes <= grupoDeLaDB.Regalos() {
 		return nil, errors.New("faltanParticipantes")
 	}
 
-	idsSorteados := make(map[int]bool, cantidadDeParticipantes)
-	sorteados := make([]int, cantidadDeParticipantes)
+	acta, err := sorteo.NuevaActa(grupoDeLaDB)
+	if err != nil {
+		return nil, err
+	}
+	if !acta.Sortear() {
+		return nil, errors.New("sorteoImposible")
+	}
+	sorteados := acta.Asignaciones
+
+	textoDelActa, err := acta.Texto()
+	if err != nil {
+		return nil, err
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoSorteado, Cuenta: solicitante, Detalle: strconv.Itoa(cantidadDeParticipantes)}
+	errorAlGuardar := lm.cambiar(&evento, func(tx *gorm.DB) error {
+		for i, participante := range grupoDeLaDB.Participantes {
+			participante.Amigxs = make([]*modelo.Participante, 0, len(sorteados[i]))
+			for _, idAmigx := range sorteados[i] {
+				participante.Amigxs = append(participante.Amigxs, grupoDeLaDB.Participantes[idAmigx])
+			}
+			participante.Notificacion = modelo.EstadoNotificacion{Estado: modelo.NotificacionPendiente}
 
-	for i := 0; i < cantidadDeParticipantes; {
-		idRandom := rand.Intn(cantidadDeParticipantes)
-		_, idYaSorteado := idsSorteados[idRandom]
+			err := lm.guardarAmigxs(tx, participante)
+			if err != nil {
+				return err
+			}
+		}
 
-		if idRandom != i && !idYaSorteado {
-			sorteados[i] = idRandom
-			idsSorteados[idRandom] = true
-			i++
+		grupoDeLaDB.YaSorteo = true
+		grupoDeLaDB.Compromiso = sorteo.Compromiso(textoDelActa)
+		grupoDeLaDB.Acta, err = lm.cifrarActa(grupoDeLaDB.ID, string(textoDelActa))
+		if err != nil {
+			return err
 		}
+		return tx.Omit("Participantes").Save(grupoDeLaDB).Error
+	})
+	if errorAlGuardar != nil {
+		return nil, errorAlGuardar
 	}
 
-	for i, participante := range grupoDeLaDB.Participantes {
-		idAmigx := sorteados[i]
-		amigx := grupoDeLaDB.Participantes[idAmigx]
-		participante.Amigx = amigx
+	return grupoDeLaDB.Participantes, nil
+}
+
+func (lm *LaMaga) ParticipantesConAmigxs(identificadorDeGrupo int64, juego string) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	if !grupoDeLaDB.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	err = lm.cargarAmigxs(lm.miBaseDeDatos, grupoDeLaDB.Participantes)
+	if err != nil {
+		return nil, err
+	}
+	return grupoDeLaDB.Participantes, nil
+}
+
+// Como ParticipantesConAmigxs, pero deja anotado que se volvieron a mandar
+func (lm *LaMaga) Renotificar(identificadorDeGrupo int64, juego string, solicitante int) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+	return lm.renotificar(grupoDeLaDB, solicitante)
+}
 
-		resultado = lm.miBaseDeDatos.Save(participante)
+func (lm *LaMaga) RenotificarPorID(id uint, solicitante int) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.juegoActivoPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	return lm.renotificar(grupoDeLaDB, solicitante)
+}
+
+func (lm *LaMaga) renotificar(grupoDeLaDB *modelo.Grupo, solicitante int) ([]*modelo.Participante, error) {
+	if !grupoDeLaDB.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	err := lm.cargarAmigxs(lm.miBaseDeDatos, grupoDeLaDB.Participantes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = anotar(lm.miBaseDeDatos, &modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoRenotificado, Cuenta: solicitante})
+	if err != nil {
+		return nil, err
+	}
+	return grupoDeLaDB.Participantes, nil
+}
+
+func (lm *LaMaga) DefinirFecha(identificadorDeGrupo int64, juego string, solicitante int, fecha time.Time) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoFecha, Cuenta: solicitante, Detalle: fecha.Format("2006-01-02")}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("fecha", fecha).Error
+	})
+}
+
+func (lm *LaMaga) DefinirPresupuesto(identificadorDeGrupo int64, juego string, solicitante int, presupuesto string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoPresupuesto, Cuenta: solicitante, Detalle: strings.TrimSpace(presupuesto)}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("presupuesto", strings.TrimSpace(presupuesto)).Error
+	})
+}
+
+// La lista de deseos se puede cambiar también después del sorteo, es lo que
+// ve quien le regala
+func (lm *LaMaga) DefinirDeseos(identificadorDeGrupo int64, juego string, identificadorDeParticipante int, deseos string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoDeseos, Cuenta: identificadorDeParticipante}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		resultado := tx.Model(&modelo.Participante{}).
+			Where(&modelo.Participante{GrupoID: grupoDeLaDB.ID, Identificador: identificadorDeParticipante}).
+			Where("se_fue = ?", false).
+			Update("deseos", strings.TrimSpace(deseos))
 		if resultado.Error != nil {
-			return nil, resultado.Error
+			return resultado.Error
+		}
+		if resultado.RowsAffected == 0 {
+			return errors.New("noParticipa")
 		}
+		return nil
+	})
+}
+
+func (lm *LaMaga) Revelar(identificadorDeGrupo int64, juego string, solicitante int, ahora time.Time, forzar bool) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
 	}
 
-	grupoDeLaDB.YaSorteo = true
-	resultado = lm.miBaseDeDatos.Omit("Participantes").Save(grupoDeLaDB)
-	if resultado.Error != nil {
-		return nil, resultado.Error
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return nil, errors.New("noEsOrganizador")
 	}
 
-	return grupoDeLaDB.Participantes, nil
+	if !forzar && (grupoDeLaDB.Fecha == nil || ahora.Before(*grupoDeLaDB.Fecha)) {
+		return nil, errors.New("todaviaNoEsLaFecha")
+	}
+
+	participantes, err := lm.ParticipantesConAmigxs(identificadorDeGrupo, grupoDeLaDB.Juego)
+	if err != nil {
+		return nil, err
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoRevelado, Cuenta: solicitante}
+	if forzar {
+		evento.Detalle = "forzado"
+	}
+	err = lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("revelado", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return modelo.EnCadena(participantes), nil
 }
 
-func (lm *LaMaga) ParticipantesConAmigxs(identificadorDeGrupo int64) ([]*modelo.Participante, error) {
-	grupoDeLaDB := modelo.Grupo{Identificador: identificadorDeGrupo}
-	resultado := lm.miBaseDeDatos.Where(&grupoDeLaDB).Preload("Participantes").First(&grupoDeLaDB)
+// El título es opcional y sirve para elegir el grupo cuando la persona
+// adivinada juega con vos en varios. Si hay más de uno devuelve los grupos
+// junto con el error adivinanzaAmbigua, sin anotar nada
+func (lm *LaMaga) Adivinar(identificadorDeParticipante int, titulo string, adivinado string) (*modelo.Grupo, []*modelo.Grupo, error) {
+	participaciones := make([]*modelo.Participante, 0)
+	resultado := lm.miBaseDeDatos.
+		Where("identificador = ?", identificadorDeParticipante).
+		Where("grupo_id IN (?)", lm.miBaseDeDatos.Model(&modelo.Grupo{}).Select("id").Where("ya_sorteo = ? AND revelado = ?", true, false)).
+		Find(&participaciones)
 	if resultado.Error != nil {
-		return nil, resultado.Error
+		return nil, nil, resultado.Error
+	}
+
+	grupos := make([]*modelo.Grupo, 0)
+	var participacionElegida *modelo.Participante
+	var adivinadoElegido *modelo.Participante
+	for _, participacion := range participaciones {
+		grupoDeLaDB := modelo.Grupo{}
+		resultado = lm.miBaseDeDatos.Preload("Participantes").First(&grupoDeLaDB, participacion.GrupoID)
+		if resultado.Error != nil {
+			return nil, nil, resultado.Error
+		}
+		if titulo != "" && !strings.EqualFold(grupoDeLaDB.Titulo(), strings.TrimSpace(titulo)) {
+			continue
+		}
+
+		for _, participante := range grupoDeLaDB.Participantes {
+			if participante.ID != participacion.ID && participante.EsQuien(adivinado) {
+				grupos = append(grupos, &grupoDeLaDB)
+				participacionElegida = participacion
+				adivinadoElegido = participante
+				break
+			}
+		}
+	}
+
+	if len(grupos) == 0 {
+		return nil, nil, errors.New("noEncontrado")
+	}
+	if len(grupos) > 1 {
+		return nil, grupos, errors.New("adivinanzaAmbigua")
+	}
+
+	evento := modelo.Evento{GrupoID: grupos[0].ID, Tipo: modelo.EventoAdivino, Cuenta: identificadorDeParticipante, ParticipanteID: &participacionElegida.ID}
+	err := lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(participacionElegida).Update("adivinanza_id", adivinadoElegido.ID).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return grupos[0], nil, nil
+}
+
+func (lm *LaMaga) Adivinanzas(identificadorDeGrupo int64, juego string) ([]Adivinanza, error) {
+	participantes, err := lm.ParticipantesConAmigxs(identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	participantesPorID := make(map[uint]*modelo.Participante, len(participantes))
+	quienesLeRegalanA := make(map[uint]map[uint]bool, len(participantes))
+	for _, participante := range participantes {
+		participantesPorID[participante.ID] = participante
+		for _, amigx := range participante.Amigxs {
+			if quienesLeRegalanA[amigx.ID] == nil {
+				quienesLeRegalanA[amigx.ID] = make(map[uint]bool)
+			}
+			quienesLeRegalanA[amigx.ID][participante.ID] = true
+		}
+	}
+
+	adivinanzas := make([]Adivinanza, 0, len(participantes))
+	for _, participante := range participantes {
+		adivinanza := Adivinanza{Participante: participante}
+		if participante.AdivinanzaID != nil {
+			adivinanza.Adivinado = participantesPorID[*participante.AdivinanzaID]
+			adivinanza.Acerto = quienesLeRegalanA[participante.ID][*participante.AdivinanzaID]
+		}
+		adivinanzas = append(adivinanzas, adivinanza)
+	}
+
+	return adivinanzas, nil
+}
+
+func (lm *LaMaga) DefinirEquipo(identificadorDeGrupo int64, juego string, identificadorDeParticipante int, equipo string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if grupoDeLaDB.YaSorteo {
+		return errors.New("yaSorteado")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoEquipo, Cuenta: identificadorDeParticipante, Detalle: strings.TrimSpace(equipo)}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		resultado := tx.Model(&modelo.Participante{}).
+			Where(&modelo.Participante{GrupoID: grupoDeLaDB.ID, Identificador: identificadorDeParticipante}).
+			Update("equipo", strings.TrimSpace(equipo))
+		if resultado.Error != nil {
+			return resultado.Error
+		}
+		if resultado.RowsAffected == 0 {
+			return errors.New("noParticipa")
+		}
+		return nil
+	})
+}
+
+func (lm *LaMaga) DefinirReglaDeEquipos(identificadorDeGrupo int64, juego string, solicitante int, regla string) error {
+	if !modelo.EsReglaDeEquipos(regla) {
+		return errors.New("reglaInvalida")
+	}
+
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	if grupoDeLaDB.YaSorteo {
+		return errors.New("yaSorteado")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoReglaDeEquipos, Cuenta: solicitante, Detalle: regla}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("regla_de_equipos", regla).Error
+	})
+}
+
+func (lm *LaMaga) DefinirHermanxs(identificadorDeGrupo int64, juego string, solicitante int, sePuedenRegalar bool) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	if grupoDeLaDB.YaSorteo {
+		return errors.New("yaSorteado")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoHermanxs, Cuenta: solicitante, Detalle: strconv.FormatBool(sePuedenRegalar)}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("hermanxs_se_regalan", sePuedenRegalar).Error
+	})
+}
+
+func (lm *LaMaga) DefinirRegalosPorPersona(identificadorDeGrupo int64, juego string, solicitante int, regalos int) error {
+	if regalos < 1 {
+		return errors.New("cantidadInvalida")
+	}
+
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	if grupoDeLaDB.YaSorteo {
+		return errors.New("yaSorteado")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoRegalosPorPersona, Cuenta: solicitante, Detalle: strconv.Itoa(regalos)}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Model(grupoDeLaDB).Update("regalos_por_persona", regalos).Error
+	})
+}
+
+func (lm *LaMaga) Compro(identificadorDeGrupo int64, juego string, identificadorDeParticipante int) error {
+	return lm.marcarRegalo(identificadorDeGrupo, juego, identificadorDeParticipante, "compro", modelo.EventoCompro)
+}
+
+func (lm *LaMaga) Recibio(identificadorDeGrupo int64, juego string, identificadorDeParticipante int) error {
+	return lm.marcarRegalo(identificadorDeGrupo, juego, identificadorDeParticipante, "recibio", modelo.EventoRecibio)
+}
+
+func (lm *LaMaga) marcarRegalo(identificadorDeGrupo int64, juego string, identificadorDeParticipante int, columna string, tipo string) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+
+	if !grupoDeLaDB.YaSorteo {
+		return errors.New("noSorteado")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: tipo, Cuenta: identificadorDeParticipante}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		resultado := tx.Model(&modelo.Participante{}).
+			Where(&modelo.Participante{GrupoID: grupoDeLaDB.ID, Identificador: identificadorDeParticipante}).
+			Update(columna, true)
+		if resultado.Error != nil {
+			return resultado.Error
+		}
+		if resultado.RowsAffected == 0 {
+			return errors.New("noParticipa")
+		}
+		return nil
+	})
+}
+
+func (lm *LaMaga) Progreso(identificadorDeGrupo int64, juego string, solicitante int) (*Progreso, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return nil, errors.New("noEsOrganizador")
 	}
 
 	if !grupoDeLaDB.YaSorteo {
 		return nil, errors.New("noSorteado")
 	}
 
+	progreso := Progreso{Grupo: grupoDeLaDB, SinComprar: make([]*modelo.Participante, 0)}
 	for _, participante := range grupoDeLaDB.Participantes {
-		amigxDeLaDB := modelo.Participante{}
-		resultado := lm.miBaseDeDatos.First(&amigxDeLaDB, *participante.AmigxID)
-		if resultado.Error != nil {
-			return nil, resultado.Error
+		if participante.SeFue {
+			continue
+		}
+		progreso.Participantes++
+		if participante.Compro {
+			progreso.Compraron++
+		} else {
+			progreso.SinComprar = append(progreso.SinComprar, participante)
+		}
+		if participante.Recibio {
+			progreso.Recibieron++
 		}
-		participante.Amigx = &amigxDeLaDB
 	}
 
-	return grupoDeLaDB.Participantes, nil
+	return &progreso, nil
 }
 
-func (lm *LaMaga) Borrar(identificadorDeGrupo int64) error {
-	grupoDeLaDB := modelo.Grupo{Identificador: identificadorDeGrupo}
-	resultado := lm.miBaseDeDatos.Where(&grupoDeLaDB).First(&grupoDeLaDB)
+func (lm *LaMaga) Archivar(identificadorDeGrupo int64, juego string, solicitante int) error {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos, identificadorDeGrupo, juego)
+	if err != nil {
+		return err
+	}
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return errors.New("noEsOrganizador")
+	}
+
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoTerminado, Cuenta: solicitante}
+	return lm.cambiar(&evento, func(tx *gorm.DB) error {
+		return tx.Delete(grupoDeLaDB).Error
+	})
+}
+
+func (lm *LaMaga) Restaurar(identificadorDeGrupo int64, juego string, solicitante int) (*modelo.Grupo, error) {
+	consulta := lm.miBaseDeDatos.Unscoped().
+		Where("identificador = ?", identificadorDeGrupo).
+		Where("archivado_en IS NOT NULL")
+	if juego != "" {
+		consulta = consulta.Where("LOWER(juego) = LOWER(?)", juego)
+	}
+	grupoDeLaDB := modelo.Grupo{}
+	resultado := consulta.Order("archivado_en DESC").First(&grupoDeLaDB)
 	if resultado.Error != nil {
-		return resultado.Error
+		return nil, resultado.Error
 	}
 
-	resultado = lm.miBaseDeDatos.Select("Participantes").Delete(grupoDeLaDB)
+	if !grupoDeLaDB.PuedeOrganizar(solicitante) {
+		return nil, errors.New("noEsOrganizador")
+	}
+	if grupoDeLaDB.ArchivadoEn.Time.Add(PlazoParaRestaurar).Before(time.Now()) {
+		return nil, errors.New("plazoVencido")
+	}
 
-	return resultado.Error
+	evento := modelo.Evento{GrupoID: grupoDeLaDB.ID, Tipo: modelo.EventoRestaurado, Cuenta: solicitante}
+	err := lm.cambiar(&evento, func(tx *gorm.DB) error {
+		err := hayJuegoActivo(tx, grupoDeLaDB.Identificador, grupoDeLaDB.Juego)
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&grupoDeLaDB).Update("archivado_en", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &grupoDeLaDB, nil
+}
+
+func (lm *LaMaga) Historial(identificadorDeGrupo int64) ([]*modelo.Grupo, error) {
+	grupos := make([]*modelo.Grupo, 0)
+	resultado := lm.miBaseDeDatos.Unscoped().Preload("Participantes").
+		Where("identificador = ?", identificadorDeGrupo).
+		Where("archivado_en IS NOT NULL").
+		Order("archivado_en DESC").
+		Find(&grupos)
+	return grupos, resultado.Error
+}
+
+func (lm *LaMaga) Purgar(identificadorDeGrupo int64, juego string, solicitante int) (int, error) {
+	consulta := lm.miBaseDeDatos.Unscoped().
+		Where("identificador = ?", identificadorDeGrupo).
+		Where("archivado_en IS NOT NULL")
+	if juego != "" {
+		consulta = consulta.Where("LOWER(juego) = LOWER(?)", juego)
+	}
+	grupos := make([]*modelo.Grupo, 0)
+	resultado := consulta.Find(&grupos)
+	if resultado.Error != nil {
+		return 0, resultado.Error
+	}
+
+	for _, grupo := range grupos {
+		if !grupo.PuedeOrganizar(solicitante) {
+			return 0, errors.New("noEsOrganizador")
+		}
+	}
+
+	err := lm.miBaseDeDatos.Transaction(func(tx *gorm.DB) error {
+		for _, grupo := range grupos {
+			resultado := tx.Where("de_id IN (?)", tx.Model(&modelo.Participante{}).Select("id").Where("grupo_id = ?", grupo.ID)).Delete(&modelo.Regalo{})
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+			resultado = tx.Unscoped().Select("Participantes").Delete(grupo)
+			if resultado.Error != nil {
+				return resultado.Error
+			}
+			err := anotar(tx, &modelo.Evento{GrupoID: grupo.ID, Tipo: modelo.EventoBorrado, Cuenta: solicitante})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(grupos), nil
 }
 
 func (lm *LaMaga) GruposDe(identificadorDeParticipante int) ([]*modelo.Grupo, error) {
 	grupos := make([]*modelo.Grupo, 0)
 	resultado := lm.miBaseDeDatos.Table("grupos").
-		Select("grupos.*").
+		Select("DISTINCT grupos.*").
 		Joins("left join participantes on participantes.grupo_id = grupos.id").
-		Where("participantes.identificador = ?", identificadorDeParticipante).
+		Where("participantes.identificador = ? OR (participantes.identificador = 0 AND participantes.responsable = ?)", identificadorDeParticipante, identificadorDeParticipante).
+		Where("grupos.archivado_en IS NULL").
+		Order("grupos.id").
 		Scan(&grupos)
 	return grupos, resultado.Error
 }
 
 func (lm *LaMaga) AmigxsDe(identificadorDeParticipante int) ([]GrupoAmigx, error) {
+	participantes := make([]*modelo.Participante, 0)
+	resultado := lm.miBaseDeDatos.
+		Where("identificador = ? OR (identificador = 0 AND responsable = ?)", identificadorDeParticipante, identificadorDeParticipante).
+		Where("grupo_id IN (?)", lm.miBaseDeDatos.Model(&modelo.Grupo{}).Select("id").Where("ya_sorteo = ?", true)).
+		Order("id").
+		Find(&participantes)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	err := lm.cargarAmigxs(lm.miBaseDeDatos, participantes)
+	if err != nil {
+		return nil, err
+	}
+
 	grupos := make([]GrupoAmigx, 0)
-	resultado := lm.miBaseDeDatos.Table("grupos").
-		Select("grupos.Nombre Grupo, Amigx.Nombre Amigx").
-		Joins("left join participantes participante on participante.grupo_id = grupos.id").
-		Joins("left join participantes Amigx on participante.amigx_id = Amigx.id").
-		Where("participante.identificador = ?", identificadorDeParticipante).
-		Where("grupos.Ya_Sorteo = true").
-		Scan(&grupos)
-	return grupos, resultado.Error
+	gruposPorID := make(map[uint]*modelo.Grupo)
+	for _, participante := range participantes {
+		grupoDeLaDB, existe := gruposPorID[participante.GrupoID]
+		if !existe {
+			grupoDeLaDB = &modelo.Grupo{}
+			resultado := lm.miBaseDeDatos.First(grupoDeLaDB, participante.GrupoID)
+			if resultado.Error != nil {
+				return nil, resultado.Error
+			}
+			gruposPorID[participante.GrupoID] = grupoDeLaDB
+		}
+		for _, amigx := range participante.Amigxs {
+			grupos = append(grupos, GrupoAmigx{
+				Grupo:        grupoDeLaDB.Nombre,
+				Juego:        grupoDeLaDB.Juego,
+				Participante: participante.Nombre,
+				ACargo:       !participante.TieneTelegram(),
+				Amigx:        amigx.Nombre,
+				Deseos:       amigx.Deseos,
+				Presupuesto:  grupoDeLaDB.Presupuesto,
+				Fecha:        grupoDeLaDB.Fecha,
+			})
+		}
+	}
+	return grupos, nil
+}
+
+// Deja anotado que alguien está mandando la notificación para que nadie más la
+// mande a la vez. Si ya la está mandando otrx o la persona se fue devuelve false.
+// Si quien la reclamó no termina, se puede volver a reclamar pasado un rato
+func (lm *LaMaga) ReclamarNotificacion(participante *modelo.Participante) (bool, error) {
+	ahora := time.Now()
+	hasta := ahora.Add(modelo.EsperaEntreIntentos)
+	resultado := lm.miBaseDeDatos.Model(&modelo.Participante{ID: participante.ID}).
+		Where("se_fue = ?", false).
+		Where("notificacion_estado <> ? OR notificacion_proximo_intento <= ?", modelo.NotificacionEnviando, ahora).
+		Updates(map[string]interface{}{"notificacion_estado": modelo.NotificacionEnviando, "notificacion_proximo_intento": hasta})
+	if resultado.Error != nil {
+		return false, resultado.Error
+	}
+	if resultado.RowsAffected == 0 {
+		return false, nil
+	}
+
+	participante.Notificacion.Estado = modelo.NotificacionEnviando
+	participante.Notificacion.ProximoIntento = &hasta
+	return true, nil
+}
+
+func (lm *LaMaga) Notificado(participante *modelo.Participante) error {
+	participante.Notificado()
+	return lm.guardarNotificacion(participante)
+}
+
+func (lm *LaMaga) NoSePudoNotificar(participante *modelo.Participante, motivo string) error {
+	participante.NoSePudoNotificar(motivo, time.Now())
+	return lm.guardarNotificacion(participante)
+}
+
+// Solo toca las columnas de la notificación, mientras se mandaba el mensaje
+// pudo haber cambiado el resto del participante o hasta haberse borrado
+func (lm *LaMaga) guardarNotificacion(participante *modelo.Participante) error {
+	resultado := lm.miBaseDeDatos.Model(&modelo.Participante{ID: participante.ID}).
+		Select("notificacion_estado", "notificacion_motivo", "notificacion_intentos", "notificacion_proximo_intento").
+		Updates(participante)
+	return resultado.Error
+}
+
+func (lm *LaMaga) EstadoDeNotificaciones(identificadorDeGrupo int64, juego string) ([]*modelo.Participante, error) {
+	grupoDeLaDB, err := lm.buscarJuego(lm.miBaseDeDatos.Preload("Participantes"), identificadorDeGrupo, juego)
+	if err != nil {
+		return nil, err
+	}
+
+	if !grupoDeLaDB.YaSorteo {
+		return nil, errors.New("noSorteado")
+	}
+
+	return grupoDeLaDB.Participantes, nil
+}
+
+func (lm *LaMaga) NotificacionesPendientesDe(identificadorDeParticipante int) ([]Notificacion, error) {
+	participantes := make([]*modelo.Participante, 0)
+	resultado := lm.miBaseDeDatos.
+		Where("identificador = ? OR (identificador = 0 AND responsable = ?)", identificadorDeParticipante, identificadorDeParticipante).
+		Where("notificacion_estado IN ?", []string{modelo.NotificacionPendiente, modelo.NotificacionFallida}).
+		Where("se_fue = ?", false).
+		Where("grupo_id IN (?)", lm.miBaseDeDatos.Model(&modelo.Grupo{}).Select("id")).
+		Find(&participantes)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	return lm.notificacionesPara(participantes)
+}
+
+func (lm *LaMaga) NotificacionesParaReintentar(ahora time.Time) ([]Notificacion, error) {
+	participantes := make([]*modelo.Participante, 0)
+	resultado := lm.miBaseDeDatos.
+		Where("notificacion_estado IN ?", []string{modelo.NotificacionFallida, modelo.NotificacionEnviando}).
+		Where("notificacion_proximo_intento <= ?", ahora).
+		Where("se_fue = ?", false).
+		Where("grupo_id IN (?)", lm.miBaseDeDatos.Model(&modelo.Grupo{}).Select("id")).
+		Find(&participantes)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	return lm.notificacionesPara(participantes)
+}
+
+func (lm *LaMaga) notificacionesPara(participantes []*modelo.Participante) ([]Notificacion, error) {
+	err := lm.cargarAmigxs(lm.miBaseDeDatos, participantes)
+	if err != nil {
+		return nil, err
+	}
+
+	notificaciones := make([]Notificacion, 0, len(participantes))
+
+	for _, participante := range participantes {
+		grupoDeLaDB := modelo.Grupo{}
+		resultado := lm.miBaseDeDatos.First(&grupoDeLaDB, participante.GrupoID)
+		if resultado.Error != nil {
+			return nil, resultado.Error
+		}
+		notificaciones = append(notificaciones, Notificacion{Grupo: grupoDeLaDB.Titulo(), Participante: participante})
+	}
+
+	return notificaciones, nil
+}
+
+func (lm *LaMaga) buscarJuego(baseDeDatos *gorm.DB, identificadorDeGrupo int64, juego string) (*modelo.Grupo, error) {
+	grupos := make([]*modelo.Grupo, 0)
+	consulta := baseDeDatos.Where("identificador = ?", identificadorDeGrupo)
+	if juego != "" {
+		consulta = consulta.Where("LOWER(juego) = LOWER(?)", juego)
+	}
+	resultado := consulta.Find(&grupos)
+	if resultado.Error != nil {
+		return nil, resultado.Error
+	}
+
+	if len(grupos) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if len(grupos) > 1 {
+		return nil, errors.New("juegoAmbiguo")
+	}
+
+	return grupos[0], nil
+}
+
+type Progreso struct {
+	Grupo         *modelo.Grupo
+	Participantes int
+	Compraron     int
+	Recibieron    int
+	SinComprar    []*modelo.Participante
+}
+
+type Adivinanza struct {
+	Participante *modelo.Participante
+	Adivinado    *modelo.Participante
+	Acerto       bool
+}
+
+type Salida struct {
+	Grupo        *modelo.Grupo
+	Participante *modelo.Participante
+}
+
+type Notificacion struct {
+	Grupo        string
+	Participante *modelo.Participante
 }
 
 type GrupoAmigx struct {
-	Grupo string
-	Amigx string
+	Grupo        string
+	Juego        string
+	Participante string
+	ACargo       bool
+	Amigx        string
+	Deseos       string
+	Presupuesto  string
+	Fecha        *time.Time
 }
@@ -1,11 +1,19 @@
 package lamaga_test
 
 import (
+	"bytes"
+	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/cifrado"
 	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/metricas"
 	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/sorteo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -14,6 +22,8 @@ import (
 
 const conexiónALaBase = "file::memory:?cache=shared"
 
+const IDOrganizador = 1
+
 type LaMagaTestSuite struct {
 	suite.Suite
 	db   *gorm.DB
@@ -26,7 +36,7 @@ func (suite *LaMagaTestSuite) SetupTest() {
 	suite.NotNil(db, "La base no debería ser nula")
 	suite.db = db
 
-	err = suite.db.AutoMigrate(&modelo.Grupo{}, &modelo.Participante{})
+	err = lamaga.PrepararBaseDeDatos(suite.db)
 	suite.NoError(err, "Debería ejecutar las migraciones")
 
 	suite.maga = lamaga.NewMaga(suite.db)
@@ -36,7 +46,7 @@ func (suite *LaMagaTestSuite) SetupTest() {
 
 func (suite *LaMagaTestSuite) TestLaMagaPuedeCrearUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
-	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 
 	suite.NoError(err, "No debería fallar al crear el grupo")
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
@@ -48,19 +58,33 @@ func (suite *LaMagaTestSuite) TestLaMagaPuedeCrearUnGrupo() {
 
 func (suite *LaMagaTestSuite) TestLaMagaNoCreaDosVecesElMismoGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	suite.EqualError(err, "ya existe ese grupo", "Debería fallar al crear el grupo 2 veces")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoCreaDosJuegosConElMismoNombre() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.NoError(suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad", "Mi grupo", IDOrganizador))
 
-	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "NAVIDAD", "Mi grupo", IDOrganizador)
+	suite.EqualError(err, "ya existe ese grupo", "Los nombres de los juegos no distinguen mayúsculas")
 
-	suite.Error(err, "Debería fallar al crear el grupo 2 veces")
+	var eventos int64
+	suite.db.Model(&modelo.Evento{}).Where("tipo = ? AND grupo_id IN (?)", modelo.EventoCreado, suite.db.Model(&modelo.Grupo{}).Select("id").Where("identificador = ?", IDNuevoGrupo)).Count(&eventos)
+	suite.Equal(int64(1), eventos, "No debería anotar el juego que no se creó")
+
+	suite.NoError(suite.maga.NuevoGrupo(IDNuevoGrupo, "Reyes", "Mi grupo", IDOrganizador), "Debería poder crear otro juego")
 }
 
 func (suite *LaMagaTestSuite) TestLaMagaPuedeAgregarUnParticipanteAUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 
 	IDNuevoParticipante := rand.Int()
-	err := suite.maga.NuevoParticipante(IDNuevoGrupo, IDNuevoParticipante, "Nick")
+	err := suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNuevoParticipante, "Nick")
 
 	suite.NoError(err, "No debería fallar al crear el participante")
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
@@ -74,18 +98,18 @@ func (suite *LaMagaTestSuite) TestLaMagaNoAgregaUnParticipanteSiNoHayUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
 	IDNuevoParticipante := rand.Int()
 
-	err := suite.maga.NuevoParticipante(IDNuevoGrupo, IDNuevoParticipante, "Nick")
+	err := suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNuevoParticipante, "Nick")
 
 	suite.Error(err, "Debería fallar al agregar participantes a un grupo inexistente")
 }
 
 func (suite *LaMagaTestSuite) TestLaMagaNosDaLosParticipantesDeUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDNuevoParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDNuevoParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNuevoParticipante, "Nick")
 
-	participantes, err := suite.maga.QuienesParticipan(IDNuevoGrupo)
+	participantes, err := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
 
 	suite.NoError(err, "No debería fallar al crear el participante")
 	suite.NotEmpty(participantes, "No debería tener participantes")
@@ -95,7 +119,7 @@ func (suite *LaMagaTestSuite) TestLaMagaNosDaLosParticipantesDeUnGrupo() {
 func (suite *LaMagaTestSuite) TestLaMagaNoListaParticipanteSiNoHayUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
 
-	participantes, err := suite.maga.QuienesParticipan(IDNuevoGrupo)
+	participantes, err := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
 
 	suite.Error(err, "Debería fallar al buscar participantes de un grupo inexistente")
 	suite.Nil(participantes, "No debería haber participantes si no hay grupo")
@@ -104,7 +128,7 @@ func (suite *LaMagaTestSuite) TestLaMagaNoListaParticipanteSiNoHayUnGrupo() {
 func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiNoHayUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
 
-	participantes, err := suite.maga.Sortear(IDNuevoGrupo)
+	participantes, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 
 	suite.Error(err, "Debería fallar al sortear en un grupo inexistente")
 	suite.Nil(participantes, "No debería haber participantes si no hay grupo")
@@ -112,15 +136,15 @@ func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiNoHayUnGrupo() {
 
 func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiYaSorteó() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDNuevoParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDNuevoParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNuevoParticipante, "Nick")
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
 	suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
 	grupoDeLaDB.YaSorteo = true
 	suite.db.Save(grupoDeLaDB)
 
-	participantes, err := suite.maga.Sortear(IDNuevoGrupo)
+	participantes, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 
 	suite.Error(err, "Debería fallar al sortear en un grupo que ya sorteó")
 	suite.Nil(participantes, "No debería haber participantes si ya había sorteado")
@@ -128,11 +152,11 @@ func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiYaSorteó() {
 
 func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiHayUnSoloParticipante() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDNuevoParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDNuevoParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNuevoParticipante, "Nick")
 
-	participantes, err := suite.maga.Sortear(IDNuevoGrupo)
+	participantes, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 
 	suite.Error(err, "Debería fallar si hay un solo participante")
 	suite.Nil(participantes, "No debería haber sorteado")
@@ -140,53 +164,53 @@ func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiHayUnSoloParticipante() {
 
 func (suite *LaMagaTestSuite) TestLaMagaSorteaAmigxs() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
 
-	participantes, err := suite.maga.Sortear(IDNuevoGrupo)
+	participantes, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 
 	suite.NoError(err, "No debería fallar al sortear")
-	suite.Equal(participantes[0].Amigx.Nombre, "Nay", "Nay debería ser amiga de Nick")
-	suite.Equal(participantes[1].Amigx.Nombre, "Nick", "Nick debería ser amigo de Nay")
+	suite.Equal(participantes[0].Amigxs[0].Nombre, "Nay", "Nay debería ser amiga de Nick")
+	suite.Equal(participantes[1].Amigxs[0].Nombre, "Nick", "Nick debería ser amigo de Nay")
 
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
 	resultado := suite.db.Preload("Participantes").Where(grupoDeLaDB).First(&grupoDeLaDB)
 	suite.NoError(resultado.Error, "Debería haber encontrado el grupo")
 	suite.True(grupoDeLaDB.YaSorteo, "Debería estar sorteado")
-	suite.Equal(*grupoDeLaDB.Participantes[0].AmigxID, grupoDeLaDB.Participantes[1].ID, "Nay debería ser amiga de Nick")
-	suite.Equal(*grupoDeLaDB.Participantes[1].AmigxID, grupoDeLaDB.Participantes[0].ID, "Nick debería ser amigo de Nay")
+	suite.Equal(grupoDeLaDB.Participantes[1].ID, *suite.regaloDe(grupoDeLaDB.Participantes[0]).ParaID, "Nay debería ser amiga de Nick")
+	suite.Equal(grupoDeLaDB.Participantes[0].ID, *suite.regaloDe(grupoDeLaDB.Participantes[1]).ParaID, "Nick debería ser amigo de Nay")
 }
 
 func (suite *LaMagaTestSuite) TestLaMagaTeDaLosParticipantesConSusAmigxs() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
-	suite.maga.Sortear(IDNuevoGrupo)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 
-	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo)
+	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
 	suite.NoError(err, "No debería fallar al buscar participantes y amigxs")
 	suite.NotNil(participantes, "Debería haber participantes")
-	suite.NotNil(participantes[0].Amigx, "Nick debería tener amigx")
-	suite.NotNil(participantes[1].Amigx, "Nay debería tener amigx")
-	suite.Equal(participantes[0].Amigx.Nombre, "Nay", "Nay debería ser amiga de Nick")
-	suite.Equal(participantes[1].Amigx.Nombre, "Nick", "Nick debería ser amigo de Nay")
+	suite.Len(participantes[0].Amigxs, 1, "Nick debería tener amigx")
+	suite.Len(participantes[1].Amigxs, 1, "Nay debería tener amigx")
+	suite.Equal(participantes[0].Amigxs[0].Nombre, "Nay", "Nay debería ser amiga de Nick")
+	suite.Equal(participantes[1].Amigxs[0].Nombre, "Nick", "Nick debería ser amigo de Nay")
 }
 
 func (suite *LaMagaTestSuite) TestLaMagaNoTeDaLosParticipantesConSusAmigxsSiNoSorteaste() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
 
-	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo)
+	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
 
 	suite.Error(err, "Debería fallar al buscar participantes y amigxs si no hizo el sorteo")
 	suite.Nil(participantes, "No debería haber participantes si no hizo el sorteo")
@@ -195,66 +219,169 @@ func (suite *LaMagaTestSuite) TestLaMagaNoTeDaLosParticipantesConSusAmigxsSiNoSo
 func (suite *LaMagaTestSuite) TestLaMagaNoTeDaLosParticipantesConSusAmigxsSiNoHayGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
 
-	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo)
+	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
 
 	suite.Error(err, "Debería fallar al buscar participantes y amigxs si no hay grupo")
 	suite.Nil(participantes, "No debería haber participantes si no hay grupo")
 }
 
-func (suite *LaMagaTestSuite) TestLaMagaTeBorraUnGrupo() {
+func (suite *LaMagaTestSuite) TestLaMagaTeArchivaUnGrupo() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 
-	err := suite.maga.Borrar(IDNuevoGrupo)
+	err := suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
 
-	suite.NoError(err, "No debería fallar al borrar un grupo")
+	suite.NoError(err, "No debería fallar al archivar un grupo")
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
 	resultado := suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
 	suite.Error(resultado.Error, "No debería haber encontrado el grupo")
 }
 
-func (suite *LaMagaTestSuite) TestLaMagaTeBorraUnGrupoYSusParticipantes() {
+func (suite *LaMagaTestSuite) TestLaMagaTeArchivaUnGrupoSinBorrarSusParticipantes() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
 	suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
 	idGrupoDB := grupoDeLaDB.ID
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
 
-	err := suite.maga.Borrar(IDNuevoGrupo)
+	err := suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
 
-	suite.NoError(err, "No debería fallar al borrar un grupo")
+	suite.NoError(err, "No debería fallar al archivar un grupo")
 	grupoDeLaDB = modelo.Grupo{Identificador: IDNuevoGrupo}
 	resultado := suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
 	suite.Error(resultado.Error, "No debería haber encontrado el grupo")
 	participantesDeLaDB := make([]*modelo.Participante, 0)
 	resultado = suite.db.Where(&modelo.Participante{GrupoID: idGrupoDB}).Find(&participantesDeLaDB)
-	suite.Equal(resultado.RowsAffected, int64(0), "No debería haber encontrado los participantes")
-	suite.Empty(participantesDeLaDB, "No debería haber encontrado los participantes")
+	suite.Equal(resultado.RowsAffected, int64(2), "Debería conservar los participantes")
+	historial, err := suite.maga.Historial(IDNuevoGrupo)
+	suite.NoError(err, "No debería fallar al buscar el historial")
+	suite.Len(historial, 1, "Debería haber un juego archivado")
+	suite.Len(historial[0].Participantes, 2, "El juego archivado debería tener sus participantes")
 }
 
-func (suite *LaMagaTestSuite) TestLaMagaNoBorraUnGrupoSiNoExiste() {
+func (suite *LaMagaTestSuite) TestLaMagaSoloArchivaYRestauraQuienOrganiza() {
 	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDOtraCuenta := rand.Int()
 
-	err := suite.maga.Borrar(IDNuevoGrupo)
+	err := suite.maga.Archivar(IDNuevoGrupo, "", IDOtraCuenta)
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organiza")
+	_, err = suite.maga.Juego(IDNuevoGrupo, "")
+	suite.NoError(err, "El juego debería seguir activo")
 
-	suite.Error(err, "Debería fallar al borrar un grupo si no está creado")
+	suite.NoError(suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador), "Quien organiza debería poder archivar")
+	_, err = suite.maga.Restaurar(IDNuevoGrupo, "", IDOtraCuenta)
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organizó")
+	historial, _ := suite.maga.Historial(IDNuevoGrupo)
+	suite.Len(historial, 1, "El juego debería seguir archivado")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPuedeComenzarOtroJuegoDespuesDeArchivar() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al comenzar otro juego")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaRestauraUnJuegoArchivado() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+
+	grupo, err := suite.maga.Restaurar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al restaurar")
+	suite.Equal("Navidad 2026", grupo.Juego, "Debería restaurar Navidad")
+	participantes, err := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.NoError(err, "Debería encontrar el juego restaurado")
+	suite.Equal([]string{"Nick"}, participantes, "Debería conservar los participantes")
+	historial, _ := suite.maga.Historial(IDNuevoGrupo)
+	suite.Empty(historial, "No debería quedar nada archivado")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoRestauraDespuesDelPlazo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+	suite.db.Unscoped().Model(&modelo.Grupo{}).
+		Where("identificador = ?", IDNuevoGrupo).
+		Update("archivado_en", time.Now().Add(-lamaga.PlazoParaRestaurar-time.Hour))
+
+	grupo, err := suite.maga.Restaurar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.EqualError(err, "plazoVencido", "Debería fallar si pasó el plazo")
+	suite.Nil(grupo, "No debería restaurar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoRestauraSiYaHayOtroJuegoIgual() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	_, err := suite.maga.Restaurar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.Error(err, "Debería fallar si ya hay un juego con el mismo nombre")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPurgaLosJuegosArchivados() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
+	suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+
+	purgados, err := suite.maga.Purgar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al purgar")
+	suite.Equal(1, purgados, "Debería purgar un juego")
+	historial, _ := suite.maga.Historial(IDNuevoGrupo)
+	suite.Empty(historial, "No debería quedar nada archivado")
+	var participantes int64
+	suite.db.Model(&modelo.Participante{}).Where("grupo_id = ?", grupoDeLaDB.ID).Count(&participantes)
+	suite.Equal(int64(0), participantes, "No debería quedar ningún participante")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloPurgaSiLoPideQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+
+	_, err := suite.maga.Purgar(IDNuevoGrupo, "", IDOrganizador+1)
+
+	suite.Error(err, "Debería fallar si no lo pide quien organiza")
+	historial, _ := suite.maga.Historial(IDNuevoGrupo)
+	suite.Len(historial, 1, "No debería purgar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoArchivaUnGrupoSiNoExiste() {
+	IDNuevoGrupo := int64(rand.Int())
+
+	err := suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.Error(err, "Debería fallar al archivar un grupo si no está creado")
 }
 
 func (suite *LaMagaTestSuite) TestLaMagaTeDiceEnQueGruposTeAnotaste() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
-	suite.maga.Sortear(IDNuevoGrupo)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 	IDOtroGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDOtroGrupo, "Mi otro grupo")
-	suite.maga.NuevoParticipante(IDOtroGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoGrupo(IDOtroGrupo, "", "Mi otro grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDOtroGrupo, "", IDUnParticipante, "Nick")
 
 	grupos, err := suite.maga.GruposDe(IDUnParticipante)
 
@@ -268,15 +395,15 @@ func (suite *LaMagaTestSuite) TestLaMagaTeDiceEnQueGruposTeAnotaste() {
 
 func (suite *LaMagaTestSuite) TestLaMagaTeDiceTodxsTusAmigxs() {
 	IDNuevoGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDNuevoGrupo, "Mi grupo")
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
 	IDUnParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
 	IDOtroParticipante := rand.Int()
-	suite.maga.NuevoParticipante(IDNuevoGrupo, IDOtroParticipante, "Nay")
-	suite.maga.Sortear(IDNuevoGrupo)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
 	IDOtroGrupo := int64(rand.Int())
-	suite.maga.NuevoGrupo(IDOtroGrupo, "Mi otro grupo")
-	suite.maga.NuevoParticipante(IDOtroGrupo, IDUnParticipante, "Nick")
+	suite.maga.NuevoGrupo(IDOtroGrupo, "", "Mi otro grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDOtroGrupo, "", IDUnParticipante, "Nick")
 
 	grupoAmigx, err := suite.maga.AmigxsDe(IDUnParticipante)
 
@@ -286,6 +413,1288 @@ func (suite *LaMagaTestSuite) TestLaMagaTeDiceTodxsTusAmigxs() {
 	suite.Equal("Nay", grupoAmigx[0].Amigx, "No coincide el nombre del Amigx")
 }
 
+func (suite *LaMagaTestSuite) TestLaMagaDejaLasNotificacionesPendientesAlSortear() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	participantes, err := suite.maga.EstadoDeNotificaciones(IDNuevoGrupo, "")
+
+	suite.NoError(err, "No debería fallar al buscar el estado de las notificaciones")
+	suite.Len(participantes, 2, "Debería haber dos participantes")
+	suite.Equal(modelo.NotificacionPendiente, participantes[0].Notificacion.Estado, "La notificación de Nick debería estar pendiente")
+	suite.Equal(modelo.NotificacionPendiente, participantes[1].Notificacion.Estado, "La notificación de Nay debería estar pendiente")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoTeDaElEstadoDeLasNotificacionesSiNoSorteaste() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	participantes, err := suite.maga.EstadoDeNotificaciones(IDNuevoGrupo, "")
+
+	suite.Error(err, "Debería fallar si no hizo el sorteo")
+	suite.Nil(participantes, "No debería haber participantes si no hizo el sorteo")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaGuardaElEstadoDeLasNotificaciones() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	err := suite.maga.Notificado(sorteados[0])
+	suite.NoError(err, "No debería fallar al guardar la notificación")
+	err = suite.maga.NoSePudoNotificar(sorteados[1], "bot bloqueado")
+	suite.NoError(err, "No debería fallar al guardar la notificación")
+
+	participantes, _ := suite.maga.EstadoDeNotificaciones(IDNuevoGrupo, "")
+	suite.Equal(modelo.NotificacionEnviada, participantes[0].Notificacion.Estado, "La notificación de Nick debería estar enviada")
+	suite.Equal(modelo.NotificacionFallida, participantes[1].Notificacion.Estado, "La notificación de Nay debería haber fallado")
+	suite.Equal("bot bloqueado", participantes[1].Notificacion.Motivo, "No coincide el motivo")
+	participantes, _ = suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.Equal(participantes[0].Amigxs[0].ID, participantes[1].ID, "No debería cambiar el amigx de Nick")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaLasNotificacionesPendientesDeUnParticipante() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Notificado(sorteados[1])
+
+	notificaciones, err := suite.maga.NotificacionesPendientesDe(IDUnParticipante)
+	suite.NoError(err, "No debería fallar al buscar notificaciones pendientes")
+	suite.Len(notificaciones, 1, "Debería haber una notificación pendiente")
+	suite.Equal("Mi grupo", notificaciones[0].Grupo, "No coincide el nombre del Grupo")
+	suite.Equal("Nay", notificaciones[0].Participante.Amigxs[0].Nombre, "No coincide el nombre del Amigx")
+
+	notificaciones, err = suite.maga.NotificacionesPendientesDe(IDOtroParticipante)
+	suite.NoError(err, "No debería fallar al buscar notificaciones pendientes")
+	suite.Empty(notificaciones, "No debería haber notificaciones pendientes")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaLasNotificacionesParaReintentar() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.NoSePudoNotificar(sorteados[0], "bot bloqueado")
+
+	notificaciones, err := suite.maga.NotificacionesParaReintentar(time.Now())
+	suite.NoError(err, "No debería fallar al buscar notificaciones para reintentar")
+	for _, notificacion := range notificaciones {
+		suite.NotEqual(sorteados[0].ID, notificacion.Participante.ID, "Todavía no debería reintentar")
+	}
+
+	notificaciones, err = suite.maga.NotificacionesParaReintentar(time.Now().Add(modelo.EsperaEntreIntentos))
+	suite.NoError(err, "No debería fallar al buscar notificaciones para reintentar")
+	encontrado := false
+	for _, notificacion := range notificaciones {
+		if notificacion.Participante.ID == sorteados[0].ID {
+			encontrado = true
+			suite.Equal("Nay", notificacion.Participante.Amigxs[0].Nombre, "No coincide el nombre del Amigx")
+		}
+	}
+	suite.True(encontrado, "Debería reintentar la notificación de Nick")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoPisaLoQueCambioMientrasNotificaba() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(suite.maga.Compro(IDNuevoGrupo, "", IDUnParticipante))
+	suite.NoError(suite.maga.Notificado(sorteados[0]), "No debería fallar al guardar la notificación")
+
+	participantes, _ := suite.maga.EstadoDeNotificaciones(IDNuevoGrupo, "")
+	suite.Equal(modelo.NotificacionEnviada, participantes[0].Notificacion.Estado, "La notificación de Nick debería estar enviada")
+	suite.True(participantes[0].Compro, "No debería perderse que Nick ya compró")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoMandaDosVecesLaMismaNotificacion() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	reclamada, err := suite.maga.ReclamarNotificacion(sorteados[0])
+	suite.NoError(err, "No debería fallar al reclamar la notificación")
+	suite.True(reclamada, "Debería poder reclamar la notificación")
+	reclamada, err = suite.maga.ReclamarNotificacion(sorteados[0])
+	suite.NoError(err, "No debería fallar al reclamar la notificación")
+	suite.False(reclamada, "No debería reclamarla dos veces")
+
+	notificaciones, _ := suite.maga.NotificacionesPendientesDe(IDUnParticipante)
+	suite.Empty(notificaciones, "No debería darla mientras se manda")
+	notificaciones, _ = suite.maga.NotificacionesParaReintentar(time.Now())
+	for _, notificacion := range notificaciones {
+		suite.NotEqual(sorteados[0].ID, notificacion.Participante.ID, "No debería reintentarla mientras se manda")
+	}
+
+	suite.NoError(suite.maga.Notificado(sorteados[0]))
+	reclamada, _ = suite.maga.ReclamarNotificacion(sorteados[0])
+	suite.True(reclamada, "Debería poder volver a mandarla una vez enviada")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoNotificaAQuienSeFue() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	sorteados, _ := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.NoSePudoNotificar(sorteados[0], "bot bloqueado")
+	_, err := suite.maga.SeFue(IDNuevoGrupo, IDUnParticipante)
+	suite.NoError(err)
+
+	notificaciones, _ := suite.maga.NotificacionesPendientesDe(IDUnParticipante)
+	suite.Empty(notificaciones, "No debería avisarle a quien se fue")
+	notificaciones, _ = suite.maga.NotificacionesParaReintentar(time.Now().Add(modelo.EsperaEntreIntentos))
+	for _, notificacion := range notificaciones {
+		suite.NotEqual(sorteados[0].ID, notificacion.Participante.ID, "No debería reintentar con quien se fue")
+	}
+	reclamada, _ := suite.maga.ReclamarNotificacion(sorteados[0])
+	suite.False(reclamada, "No debería mandarle nada a quien se fue")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaActualizaLaIdentidadDeUnParticipanteEnTodosSusGrupos() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDOtroGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDOtroGrupo, "", "Mi otro grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	suite.maga.NuevoParticipante(IDOtroGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+
+	err := suite.maga.ActualizarIdentidad(IDUnParticipante, "nickrisaro", "Nicolás", "Risaro")
+
+	suite.NoError(err, "No debería fallar al actualizar la identidad")
+	participantesDeLaDB := make([]*modelo.Participante, 0)
+	suite.db.Where(&modelo.Participante{Identificador: IDUnParticipante}).Find(&participantesDeLaDB)
+	suite.Len(participantesDeLaDB, 2, "Debería estar en dos grupos")
+	for _, participante := range participantesDeLaDB {
+		suite.Equal("Nicolás Risaro", participante.Nombre, "No coincide el nombre")
+		suite.Equal("nickrisaro", participante.Usuario, "No coincide el usuario")
+	}
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Contains(participantes, "Nay", "No debería cambiar el nombre de Nay")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaMigraUnGrupoSinPerderElJuego() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	IDSuperGrupo := -int64(rand.Int())
+
+	err := suite.maga.Migrar(IDNuevoGrupo, IDSuperGrupo)
+
+	suite.NoError(err, "No debería fallar al migrar el grupo")
+	_, err = suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Error(err, "No debería encontrar el grupo con el identificador viejo")
+	participantes, err := suite.maga.ParticipantesConAmigxs(IDSuperGrupo, "")
+	suite.NoError(err, "Debería encontrar el grupo con el identificador nuevo")
+	suite.Len(participantes, 2, "Debería conservar los participantes")
+	suite.Equal("Nay", participantes[0].Amigxs[0].Nombre, "Debería conservar el sorteo")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoFallaAlMigrarUnGrupoQueNoExiste() {
+	err := suite.maga.Migrar(int64(rand.Int()), -int64(rand.Int()))
+
+	suite.NoError(err, "No debería fallar al migrar un grupo que no existe")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaRenombraUnGrupo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.Renombrar(IDNuevoGrupo, "Mi grupo renombrado")
+
+	suite.NoError(err, "No debería fallar al renombrar el grupo")
+	grupoDeLaDB := modelo.Grupo{Identificador: IDNuevoGrupo}
+	suite.db.Where(grupoDeLaDB).First(&grupoDeLaDB)
+	suite.Equal("Mi grupo renombrado", grupoDeLaDB.Nombre, "No coincide el nombre del grupo")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSacaDelGrupoAQuienSeFueAntesDelSorteo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+
+	salidas, err := suite.maga.SeFue(IDNuevoGrupo, IDUnParticipante)
+
+	suite.NoError(err, "No debería fallar al sacar al participante")
+	suite.Len(salidas, 1, "Debería haber salido de un juego")
+	suite.False(salidas[0].Grupo.YaSorteo, "No debería estar sorteado")
+	suite.Equal("Nick", salidas[0].Participante.Nombre, "No coincide el nombre de quien se fue")
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Equal([]string{"Nay"}, participantes, "Sólo debería quedar Nay")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoHaceNadaSiSeFueAlguienQueNoParticipa() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	salidas, err := suite.maga.SeFue(IDNuevoGrupo, rand.Int())
+
+	suite.NoError(err, "No debería fallar si no participaba")
+	suite.Empty(salidas, "No debería haber salido de ningún juego")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaMarcaAQuienSeFueDespuesDelSorteo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	salidas, err := suite.maga.SeFue(IDNuevoGrupo, IDUnParticipante)
+
+	suite.NoError(err, "No debería fallar al marcar al participante")
+	suite.Len(salidas, 1, "Debería haber salido de un juego")
+	suite.True(salidas[0].Grupo.YaSorteo, "Debería estar sorteado")
+	suite.Equal(IDOrganizador, salidas[0].Grupo.Organizador, "No coincide el organizador")
+	suite.True(salidas[0].Participante.SeFue, "Debería estar marcado")
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Len(participantes, 2, "No debería sacarlo hasta reenlazar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaReenlazaLaCadenaDeQuienSeFue() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.SeFue(IDNuevoGrupo, participantes[1].Identificador)
+
+	reenlazados, err := suite.maga.Reenlazar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al reenlazar")
+	suite.Len(reenlazados, 1, "Sólo debería cambiar el amigx de Nick")
+	suite.Equal("Nick", reenlazados[0].Nombre, "Debería cambiar el amigx de Nick")
+	suite.Equal("Juli", reenlazados[0].Amigxs[0].Nombre, "Nick debería regalarle a Juli")
+	suite.Equal(modelo.NotificacionPendiente, reenlazados[0].Notificacion.Estado, "Hay que avisarle a Nick")
+	conAmigxs, _ := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.Len(conAmigxs, 2, "Debería quedar sin Nay")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaReenlazaAQuienSeQuedaSinPareja() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli", "Lu")
+	suite.asignar(participantes[0], participantes[1])
+	suite.asignar(participantes[1], participantes[0])
+	suite.asignar(participantes[2], participantes[3])
+	suite.asignar(participantes[3], participantes[2])
+	suite.maga.SeFue(IDNuevoGrupo, participantes[1].Identificador)
+
+	reenlazados, err := suite.maga.Reenlazar(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al reenlazar")
+	suite.Len(reenlazados, 2, "Debería cambiar el amigx de Nick y de alguien más")
+	conAmigxs, _ := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.Len(conAmigxs, 3, "Debería quedar sin Nay")
+	regalados := make(map[string]bool)
+	for _, participante := range conAmigxs {
+		suite.NotEqual(participante.Nombre, participante.Amigxs[0].Nombre, "Nadie se regala a sí mismx")
+		regalados[participante.Amigxs[0].Nombre] = true
+	}
+	suite.Len(regalados, 3, "Cada persona debería recibir un regalo")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaReenlazaCuandoSeVanDosQueSeRegalaban() {
+	IDEnCadena := int64(rand.Int())
+	enCadena := suite.grupoSorteadoEnCadena(IDEnCadena, "Nick", "Nay", "Juli", "Lu", "Sol")
+	suite.maga.SeFue(IDEnCadena, enCadena[1].Identificador)
+	suite.maga.SeFue(IDEnCadena, enCadena[2].Identificador)
+	IDEnPareja := int64(rand.Int())
+	enPareja := suite.grupoSorteadoEnCadena(IDEnPareja, "Nick", "Nay", "Juli", "Lu")
+	suite.asignar(enPareja[0], enPareja[3])
+	suite.asignar(enPareja[3], enPareja[0])
+	suite.asignar(enPareja[1], enPareja[2])
+	suite.asignar(enPareja[2], enPareja[1])
+	suite.maga.SeFue(IDEnPareja, enPareja[1].Identificador)
+	suite.maga.SeFue(IDEnPareja, enPareja[2].Identificador)
+
+	for _, IDGrupo := range []int64{IDEnCadena, IDEnPareja} {
+		_, err := suite.maga.Reenlazar(IDGrupo, "", IDOrganizador)
+		suite.NoError(err, "No debería fallar al reenlazar")
+
+		conAmigxs, _ := suite.maga.ParticipantesConAmigxs(IDGrupo, "")
+		regalados := make(map[string]bool)
+		for _, participante := range conAmigxs {
+			suite.Len(participante.Amigxs, 1, "Cada persona debería hacer un regalo")
+			suite.NotContains([]string{participante.Nombre, "Nay", "Juli"}, participante.Amigxs[0].Nombre, "Nadie le regala a sí mismx ni a quienes se fueron")
+			regalados[participante.Amigxs[0].Nombre] = true
+		}
+		suite.Len(regalados, len(conAmigxs), "Cada persona debería recibir un regalo")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloReenlazaSiLoPideQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.SeFue(IDNuevoGrupo, participantes[1].Identificador)
+
+	reenlazados, err := suite.maga.Reenlazar(IDNuevoGrupo, "", participantes[0].Identificador)
+
+	suite.Error(err, "Debería fallar si no lo pide quien organiza")
+	suite.Nil(reenlazados, "No debería reenlazar")
+}
+
+func (suite *LaMagaTestSuite) grupoSorteadoEnCadena(identificadorDeGrupo int64, nombres ...string) []*modelo.Participante {
+	suite.maga.NuevoGrupo(identificadorDeGrupo, "", "Mi grupo", IDOrganizador)
+	for _, nombre := range nombres {
+		suite.maga.NuevoParticipante(identificadorDeGrupo, "", rand.Int(), nombre)
+	}
+	participantes, err := suite.maga.Sortear(identificadorDeGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear")
+
+	for i, participante := range participantes {
+		suite.asignar(participante, participantes[(i+1)%len(participantes)])
+	}
+	return participantes
+}
+
+func (suite *LaMagaTestSuite) asignar(participante *modelo.Participante, amigxs ...*modelo.Participante) {
+	participante.Amigxs = amigxs
+	suite.db.Where("de_id = ?", participante.ID).Delete(&modelo.Regalo{})
+	for _, amigx := range amigxs {
+		suite.db.Create(&modelo.Regalo{DeID: participante.ID, ParaID: &amigx.ID})
+	}
+}
+
+func (suite *LaMagaTestSuite) regaloDe(participante *modelo.Participante) *modelo.Regalo {
+	regalo := modelo.Regalo{}
+	resultado := suite.db.Where("de_id = ?", participante.ID).First(&regalo)
+	suite.NoError(resultado.Error, "Debería tener un regalo")
+	return &regalo
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPuedeTenerVariosJuegosEnUnGrupo() {
+	IDNuevoGrupo := int64(rand.Int())
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+	suite.NoError(err, "No debería fallar al crear el primer juego")
+	err = suite.maga.NuevoGrupo(IDNuevoGrupo, "Reyes 2027", "Mi grupo", IDOrganizador)
+	suite.NoError(err, "No debería fallar al crear el segundo juego")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "Navidad 2026", rand.Int(), "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "reyes 2027", rand.Int(), "Nay")
+
+	enNavidad, err := suite.maga.QuienesParticipan(IDNuevoGrupo, "Navidad 2026")
+	suite.NoError(err, "No debería fallar al listar el primer juego")
+	suite.Equal([]string{"Nick"}, enNavidad, "Nick juega en Navidad")
+	enReyes, err := suite.maga.QuienesParticipan(IDNuevoGrupo, "Reyes 2027")
+	suite.NoError(err, "No debería fallar al listar el segundo juego")
+	suite.Equal([]string{"Nay"}, enReyes, "Nay juega en Reyes")
+	juegos, err := suite.maga.Juegos(IDNuevoGrupo)
+	suite.NoError(err, "No debería fallar al listar los juegos")
+	suite.Len(juegos, 2, "Debería haber dos juegos")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoCreaDosVecesElMismoJuego() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+
+	suite.Error(err, "Debería fallar al crear el juego 2 veces")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaUsaElUnicoJuegoSiNoLeDicenCual() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+
+	suite.NoError(err, "No debería fallar si hay un único juego")
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "Navidad 2026")
+	suite.Equal([]string{"Nick"}, participantes, "Nick debería jugar en Navidad")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNecesitaSaberElJuegoSiHayVarios() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "Navidad 2026", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "Reyes 2027", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+
+	suite.EqualError(err, "juegoAmbiguo", "Debería fallar si no sabe en qué juego anotar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaRevelaLosAmigxsDespuesDeLaFecha() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	fecha := time.Date(2026, time.December, 24, 0, 0, 0, 0, time.Local)
+	err := suite.maga.DefinirFecha(IDNuevoGrupo, "", IDOrganizador, fecha)
+	suite.NoError(err, "No debería fallar al definir la fecha")
+
+	revelados, err := suite.maga.Revelar(IDNuevoGrupo, "", IDOrganizador, fecha.Add(time.Hour), false)
+
+	suite.NoError(err, "No debería fallar al revelar")
+	suite.Len(revelados, 3, "Debería revelar a todxs")
+	suite.Equal(participantes[0].ID, revelados[0].ID, "Debería empezar por Nick")
+	suite.Equal("Nay", revelados[0].Amigxs[0].Nombre, "Nick le regaló a Nay")
+	suite.Equal("Juli", revelados[1].Amigxs[0].Nombre, "Nay le regaló a Juli")
+	suite.Equal("Nick", revelados[2].Amigxs[0].Nombre, "Juli le regaló a Nick")
+	grupo, _ := suite.maga.Juego(IDNuevoGrupo, "")
+	suite.True(grupo.Revelado, "Debería quedar revelado")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoRevelaAntesDeLaFecha() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	fecha := time.Date(2026, time.December, 24, 0, 0, 0, 0, time.Local)
+	suite.maga.DefinirFecha(IDNuevoGrupo, "", IDOrganizador, fecha)
+
+	revelados, err := suite.maga.Revelar(IDNuevoGrupo, "", IDOrganizador, fecha.Add(-time.Hour), false)
+
+	suite.EqualError(err, "todaviaNoEsLaFecha", "Debería fallar antes de la fecha")
+	suite.Nil(revelados, "No debería revelar")
+
+	revelados, err = suite.maga.Revelar(IDNuevoGrupo, "", IDOrganizador, fecha.Add(-time.Hour), true)
+
+	suite.NoError(err, "Debería revelar si se confirma")
+	suite.Len(revelados, 3, "Debería revelar a todxs")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloRevelaSiLoPideQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+
+	revelados, err := suite.maga.Revelar(IDNuevoGrupo, "", participantes[0].Identificador, time.Now(), true)
+
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no lo pide quien organiza")
+	suite.Nil(revelados, "No debería revelar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaAnotaQuienCreesQueTeRegala() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.ActualizarIdentidad(participantes[2].Identificador, "juli", "Juli", "")
+
+	grupo, _, err := suite.maga.Adivinar(participantes[0].Identificador, "", "@juli")
+	suite.NoError(err, "No debería fallar al adivinar")
+	suite.Equal(IDNuevoGrupo, grupo.Identificador, "Debería adivinar en el grupo")
+	_, _, err = suite.maga.Adivinar(participantes[1].Identificador, "", "juli")
+	suite.NoError(err, "No debería fallar al adivinar")
+
+	adivinanzas, err := suite.maga.Adivinanzas(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería fallar al buscar las adivinanzas")
+	suite.Len(adivinanzas, 3, "Debería haber una adivinanza por participante")
+	suite.Equal("Juli", adivinanzas[0].Adivinado.Nombre, "Nick cree que Juli le regala")
+	suite.True(adivinanzas[0].Acerto, "Juli le regala a Nick")
+	suite.Equal("Juli", adivinanzas[1].Adivinado.Nombre, "Nay cree que Juli le regala")
+	suite.False(adivinanzas[1].Acerto, "Nick le regala a Nay")
+	suite.Nil(adivinanzas[2].Adivinado, "Juli no adivinó")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoTeDejaAdivinarQueTeRegalasVos() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+
+	grupo, _, err := suite.maga.Adivinar(participantes[0].Identificador, "", "Nick")
+
+	suite.EqualError(err, "noEncontrado", "No debería poder adivinarse a sí mismx")
+	suite.Nil(grupo, "No debería adivinar en ningún grupo")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPreguntaEnQueGrupoAdivinasSiHayVarios() {
+	IDUnGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDUnGrupo, "Nick", "Nay", "Juli")
+	IDOtroGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDOtroGrupo, "", "Los primos", IDOrganizador)
+	suite.maga.NuevoParticipante(IDOtroGrupo, "", participantes[0].Identificador, "Nick")
+	suite.maga.NuevoParticipante(IDOtroGrupo, "", participantes[2].Identificador, "Juli")
+	_, err := suite.maga.Sortear(IDOtroGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear el otro grupo")
+
+	grupo, grupos, err := suite.maga.Adivinar(participantes[0].Identificador, "", "Juli")
+	suite.EqualError(err, "adivinanzaAmbigua", "Debería fallar si Juli juega en los dos grupos")
+	suite.Nil(grupo, "No debería adivinar en ningún grupo")
+	suite.Len(grupos, 2, "Debería devolver los dos grupos")
+	adivinanzas, _ := suite.maga.Adivinanzas(IDUnGrupo, "")
+	suite.Nil(adivinanzas[0].Adivinado, "No debería anotar la adivinanza")
+
+	grupo, _, err = suite.maga.Adivinar(participantes[0].Identificador, "los PRIMOS", "Juli")
+	suite.NoError(err, "Debería adivinar en el grupo elegido")
+	suite.Equal(IDOtroGrupo, grupo.Identificador, "Debería ser el grupo Los primos")
+	adivinanzas, _ = suite.maga.Adivinanzas(IDUnGrupo, "")
+	suite.Nil(adivinanzas[0].Adivinado, "No debería anotar la adivinanza en el otro grupo")
+	adivinanzas, _ = suite.maga.Adivinanzas(IDOtroGrupo, "")
+	suite.Equal("Juli", adivinanzas[0].Adivinado.Nombre, "Debería anotar la adivinanza en Los primos")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoTeDejaAdivinarDespuesDeRevelar() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.Revelar(IDNuevoGrupo, "", IDOrganizador, time.Now(), true)
+
+	_, _, err := suite.maga.Adivinar(participantes[0].Identificador, "", "Juli")
+
+	suite.EqualError(err, "noEncontrado", "No debería poder adivinar después de revelar")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaLlevaLaCuentaDeLosRegalos() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+
+	err := suite.maga.Compro(IDNuevoGrupo, "", participantes[0].Identificador)
+	suite.NoError(err, "No debería fallar al marcar el regalo comprado")
+	err = suite.maga.Compro(IDNuevoGrupo, "", participantes[1].Identificador)
+	suite.NoError(err, "No debería fallar al marcar el regalo comprado")
+	err = suite.maga.Recibio(IDNuevoGrupo, "", participantes[1].Identificador)
+	suite.NoError(err, "No debería fallar al marcar el regalo recibido")
+
+	progreso, err := suite.maga.Progreso(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al ver el progreso")
+	suite.Equal(3, progreso.Participantes, "Debería haber tres participantes")
+	suite.Equal(2, progreso.Compraron, "Dos personas compraron")
+	suite.Equal(1, progreso.Recibieron, "Una persona recibió")
+	suite.Len(progreso.SinComprar, 1, "Falta que compre una persona")
+	suite.Equal("Juli", progreso.SinComprar[0].Nombre, "Falta que compre Juli")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoMarcaRegalosDeQuienNoParticipa() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay")
+
+	err := suite.maga.Compro(IDNuevoGrupo, "", rand.Int())
+
+	suite.EqualError(err, "noParticipa", "Debería fallar si no participa")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoMarcaRegalosAntesDelSorteo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+
+	err := suite.maga.Compro(IDNuevoGrupo, "", IDUnParticipante)
+
+	suite.EqualError(err, "noSorteado", "Debería fallar si no sorteó")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloMuestraElProgresoAQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay")
+
+	progreso, err := suite.maga.Progreso(IDNuevoGrupo, "", participantes[0].Identificador)
+
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no lo pide quien organiza")
+	suite.Nil(progreso, "No debería mostrar el progreso")
+}
+
+func (suite *LaMagaTestSuite) grupoConEquipos(identificadorDeGrupo int64, regla string, equipos ...string) {
+	suite.maga.NuevoGrupo(identificadorDeGrupo, "", "Mi grupo", IDOrganizador)
+	for _, equipo := range equipos {
+		IDParticipante := rand.Int()
+		suite.maga.NuevoParticipante(identificadorDeGrupo, "", IDParticipante, "Persona de "+equipo)
+		err := suite.maga.DefinirEquipo(identificadorDeGrupo, "", IDParticipante, equipo)
+		suite.NoError(err, "No debería fallar al definir el equipo")
+	}
+	err := suite.maga.DefinirReglaDeEquipos(identificadorDeGrupo, "", IDOrganizador, regla)
+	suite.NoError(err, "No debería fallar al definir la regla")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSorteaEntreEquiposDistintos() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.grupoConEquipos(IDNuevoGrupo, modelo.EquiposDistintos, "Ventas", "Ventas", "Ventas", "Sistemas", "Sistemas", "Sistemas")
+
+	for i := 0; i < 10; i++ {
+		suite.db.Model(&modelo.Grupo{}).Where("identificador = ?", IDNuevoGrupo).Update("ya_sorteo", false)
+		sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+		suite.NoError(err, "No debería fallar al sortear")
+		for _, participante := range sorteados {
+			suite.NotEqual(participante.Equipo, participante.Amigxs[0].Equipo, "Debería regalarle a alguien de otro equipo")
+		}
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSorteaDentroDelMismoEquipo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.grupoConEquipos(IDNuevoGrupo, modelo.MismoEquipo, "Ventas", "Sistemas", "Ventas", "Sistemas", "Ventas")
+
+	sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al sortear")
+	for _, participante := range sorteados {
+		suite.Equal(participante.Equipo, participante.Amigxs[0].Equipo, "Debería regalarle a alguien de su equipo")
+		suite.NotEqual(participante.Identificador, participante.Amigxs[0].Identificador, "No debería regalarse a sí mismx")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiLosEquiposNoLoPermiten() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.grupoConEquipos(IDNuevoGrupo, modelo.EquiposDistintos, "Ventas", "Ventas", "Ventas", "Sistemas")
+
+	sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.EqualError(err, "sorteoImposible", "Debería fallar si no hay forma de sortear")
+	suite.Nil(sorteados, "No debería sortear")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloDejaDefinirLaReglaDeEquiposAQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.DefinirReglaDeEquipos(IDNuevoGrupo, "", rand.Int(), modelo.MismoEquipo)
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organiza")
+
+	err = suite.maga.DefinirReglaDeEquipos(IDNuevoGrupo, "", IDOrganizador, "cualquiera")
+	suite.EqualError(err, "reglaInvalida", "Debería fallar si la regla no existe")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoCambiaElEquipoDeQuienNoParticipa() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.DefinirEquipo(IDNuevoGrupo, "", rand.Int(), "Ventas")
+
+	suite.EqualError(err, "noParticipa", "Debería fallar si no participa")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaLeMuestraLosDeseosYElPresupuestoAQuienRegala() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDUnParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDUnParticipante, "Nick")
+	IDOtroParticipante := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOtroParticipante, "Nay")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(suite.maga.DefinirPresupuesto(IDNuevoGrupo, "", IDOrganizador, " hasta $5000 "))
+	suite.NoError(suite.maga.DefinirDeseos(IDNuevoGrupo, "", IDOtroParticipante, "un libro de cuentos"), "Debería poder cambiar sus deseos después del sorteo")
+
+	grupoAmigx, err := suite.maga.AmigxsDe(IDUnParticipante)
+	suite.NoError(err)
+	suite.Require().Len(grupoAmigx, 1)
+	suite.Equal("un libro de cuentos", grupoAmigx[0].Deseos, "Debería ver lo que le gustaría a su amigx")
+	suite.Equal("hasta $5000", grupoAmigx[0].Presupuesto, "Debería ver el presupuesto")
+
+	grupoAmigx, _ = suite.maga.AmigxsDe(IDOtroParticipante)
+	suite.Empty(grupoAmigx[0].Deseos, "Nick todavía no anotó nada")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloDejaDefinirElPresupuestoAQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.DefinirPresupuesto(IDNuevoGrupo, "", rand.Int(), "$5000")
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organiza")
+
+	err = suite.maga.DefinirDeseos(IDNuevoGrupo, "", rand.Int(), "un libro")
+	suite.EqualError(err, "noParticipa", "Debería fallar si no participa")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSorteaVariosRegalosPorPersona() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	for _, nombre := range []string{"Nick", "Nay", "Juli", "Lu", "Sol"} {
+		suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), nombre)
+	}
+	err := suite.maga.DefinirRegalosPorPersona(IDNuevoGrupo, "", IDOrganizador, 2)
+	suite.NoError(err, "No debería fallar al definir los regalos por persona")
+
+	_, err = suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear")
+
+	participantes, err := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería fallar al buscar los amigxs")
+	recibidos := make(map[uint]int)
+	for _, participante := range participantes {
+		suite.Len(participante.Amigxs, 2, "Cada persona debería hacer dos regalos")
+		suite.NotEqual(participante.Amigxs[0].ID, participante.Amigxs[1].ID, "No debería regalarle dos veces a la misma persona")
+		for _, amigx := range participante.Amigxs {
+			suite.NotEqual(participante.ID, amigx.ID, "Nadie se regala a sí mismx")
+			recibidos[amigx.ID]++
+		}
+	}
+	for _, participante := range participantes {
+		suite.Equal(2, recibidos[participante.ID], "Cada persona debería recibir dos regalos")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoSorteaSiHayMenosParticipantesQueRegalos() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nay")
+	suite.maga.DefinirRegalosPorPersona(IDNuevoGrupo, "", IDOrganizador, 2)
+
+	_, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.EqualError(err, "faltanParticipantes", "Debería fallar si no hay suficientes personas para los regalos")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloDejaDefinirLosRegalosPorPersonaAQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.DefinirRegalosPorPersona(IDNuevoGrupo, "", rand.Int(), 2)
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organiza")
+
+	err = suite.maga.DefinirRegalosPorPersona(IDNuevoGrupo, "", IDOrganizador, 0)
+	suite.EqualError(err, "cantidadInvalida", "Debería fallar si la cantidad no es positiva")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaReenlazaConVariosRegalosPorPersona() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDs := make([]int, 0)
+	for _, nombre := range []string{"Nick", "Nay", "Juli", "Lu", "Sol"} {
+		IDParticipante := rand.Int()
+		IDs = append(IDs, IDParticipante)
+		suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDParticipante, nombre)
+	}
+	suite.maga.DefinirRegalosPorPersona(IDNuevoGrupo, "", IDOrganizador, 2)
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.SeFue(IDNuevoGrupo, IDs[0])
+
+	_, err := suite.maga.Reenlazar(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al reenlazar")
+
+	participantes, _ := suite.maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.Len(participantes, 4, "Deberían quedar cuatro personas")
+	recibidos := make(map[uint]int)
+	for _, participante := range participantes {
+		suite.Len(participante.Amigxs, 2, "Cada persona debería seguir haciendo dos regalos")
+		for _, amigx := range participante.Amigxs {
+			suite.NotEqual(participante.ID, amigx.ID, "Nadie se regala a sí mismx")
+			recibidos[amigx.ID]++
+		}
+	}
+	for _, participante := range participantes {
+		suite.Equal(2, recibidos[participante.ID], "Cada persona debería seguir recibiendo dos regalos")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaTodxsTusAmigxs() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.asignar(participantes[0], participantes[1], participantes[2])
+
+	grupoAmigx, err := suite.maga.AmigxsDe(participantes[0].Identificador)
+
+	suite.NoError(err, "No debería fallar al buscar los amigxs")
+	suite.Len(grupoAmigx, 2, "Debería tener dos amigxs")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaAgregaParticipantesSinTelegram() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuela Rosa", "")
+	suite.NoError(err, "No debería fallar al agregar a alguien sin Telegram")
+	err = suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuelo Tito", "")
+	suite.NoError(err, "No debería fallar al agregar a otra persona sin Telegram")
+
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Equal([]string{"Abuela Rosa", "Abuelo Tito"}, participantes, "Deberían participar las dos personas")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSorteaEntreDosPersonasSinTelegram() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuela Rosa", "")
+	suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuelo Tito", "")
+	// Quien organiza está a cargo de lxs dos, así que son hermanxs
+	suite.maga.DefinirHermanxs(IDNuevoGrupo, "", IDOrganizador, true)
+
+	sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "Dos personas sin Telegram no son la misma persona aunque no tengan cuenta")
+	suite.Len(sorteados, 2, "Deberían participar las dos personas")
+	for _, participante := range sorteados {
+		suite.NotEqual(participante.Nombre, participante.Amigxs[0].Nombre, "Nadie se regala a sí mismx")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoAgregaDosVecesAlguienSinTelegram() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuela Rosa", "")
+
+	err := suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "abuela rosa", "")
+
+	suite.EqualError(err, "yaParticipa", "Debería fallar si ya participa")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloDejaAgregarSinTelegramAQuienOrganiza() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", rand.Int(), "Abuela Rosa", "")
+
+	suite.EqualError(err, "noEsOrganizador", "Debería fallar si no es quien organiza")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoAgregaSinTelegramSiNoEncuentraAlResponsable() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+
+	err := suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuela Rosa", "@nadie")
+
+	suite.EqualError(err, "responsableNoEncontrado", "Debería fallar si no encuentra al responsable")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaLeAvisaAlResponsableDeQuienNoTieneTelegram() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDResponsable := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDResponsable, "Nick")
+	suite.maga.ActualizarIdentidad(IDResponsable, "nickrisaro", "Nick", "")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Juli")
+	err := suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Abuela Rosa", "@nickrisaro")
+	suite.NoError(err, "No debería fallar al agregar a alguien sin Telegram")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	notificaciones, err := suite.maga.NotificacionesPendientesDe(IDResponsable)
+
+	suite.NoError(err, "No debería fallar al buscar notificaciones")
+	suite.Len(notificaciones, 2, "Debería recibir su notificación y la de la abuela")
+	for _, notificacion := range notificaciones {
+		suite.Equal(IDResponsable, notificacion.Participante.Destinatario(), "La notificación debería llegarle al responsable")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestUnaCuentaPuedeTenerVariosParticipantesACargo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDCuenta := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDCuenta, "Nick")
+
+	err := suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "Juani")
+	suite.NoError(err, "No debería fallar al agregar a alguien a cargo")
+	err = suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "Sofi")
+	suite.NoError(err, "No debería fallar al agregar a otra persona a cargo")
+	err = suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "sofi")
+	suite.EqualError(err, "yaParticipa", "No debería agregar dos veces a la misma persona")
+
+	participantes, _ := suite.maga.QuienesParticipan(IDNuevoGrupo, "")
+	suite.Equal([]string{"Nick", "Juani", "Sofi"}, participantes, "Deberían participar las tres personas")
+	grupos, _ := suite.maga.GruposDe(IDCuenta)
+	suite.Len(grupos, 1, "El grupo debería aparecer una sola vez")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoSorteaEntreHermanxs() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDCuenta := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDCuenta, "Nick")
+	suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "Juani")
+	for _, nombre := range []string{"Nay", "Juli", "Lu"} {
+		suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), nombre)
+	}
+
+	for i := 0; i < 10; i++ {
+		suite.db.Model(&modelo.Grupo{}).Where("identificador = ?", IDNuevoGrupo).Update("ya_sorteo", false)
+		sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+		suite.NoError(err, "No debería fallar al sortear")
+		for _, participante := range sorteados {
+			suite.False(participante.EsHermanx(participante.Amigxs[0]), "No debería regalarle a su hermanx")
+		}
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPuedeSortearEntreHermanxsSiSeLoPiden() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDCuenta := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDCuenta, "Nick")
+	suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "Juani")
+
+	_, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.EqualError(err, "sorteoImposible", "No debería poder sortear sólo entre hermanxs")
+
+	err = suite.maga.DefinirHermanxs(IDNuevoGrupo, "", IDOrganizador, true)
+	suite.NoError(err, "No debería fallar al permitir regalos entre hermanxs")
+	_, err = suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "Debería poder sortear entre hermanxs")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaLosAmigxsDeQuienesTenésACargo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	IDCuenta := rand.Int()
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDCuenta, "Nick")
+	suite.maga.NuevoParticipanteACargo(IDNuevoGrupo, "", IDCuenta, "Juani")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Juli")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	grupoAmigx, err := suite.maga.AmigxsDe(IDCuenta)
+
+	suite.NoError(err, "No debería fallar al buscar los amigxs")
+	suite.Len(grupoAmigx, 2, "Debería tener los amigxs de Nick y de Juani")
+	participantes := []string{grupoAmigx[0].Participante, grupoAmigx[1].Participante}
+	suite.ElementsMatch([]string{"Nick", "Juani"}, participantes, "Deberían ser los amigxs de Nick y de Juani")
+	for _, amigx := range grupoAmigx {
+		suite.Equal(amigx.Participante == "Juani", amigx.ACargo, "Sólo Juani está a cargo")
+	}
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaGuardaElActaDelSorteo() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	for _, nombre := range []string{"Nick", "Nay", "Juli"} {
+		suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), nombre)
+	}
+	sorteados, err := suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear")
+
+	grupo, _ := suite.maga.Juego(IDNuevoGrupo, "")
+	suite.Equal(sorteo.Compromiso([]byte(grupo.Acta)), grupo.Compromiso, "El compromiso debería ser el hash del acta")
+	acta, err := sorteo.LeerActa([]byte(grupo.Acta))
+	suite.NoError(err, "Debería poder leer el acta")
+	suite.NoError(acta.Verificar(), "El acta debería verificarse")
+	for de, asignadas := range acta.Asignaciones {
+		suite.Equal(sorteados[de].Nombre, acta.Participantes[de].Nombre, "El acta debería tener a las personas en el orden del sorteo")
+		suite.Equal(sorteados[de].Amigxs[0].Nombre, acta.Participantes[asignadas[0]].Nombre, "El acta debería tener el resultado del sorteo")
+	}
+}
+
+// Las pruebas con claves usan su propia base porque Recifrar cambia todos los regalos
+func (suite *LaMagaTestSuite) baseAparte() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:aparte%d?mode=memory&cache=shared", rand.Int())), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.NoError(err, "Debería conectarse a la base de datos")
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "Debería ejecutar las migraciones")
+	return db
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPasaLosAmigxsViejosARegalos() {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:vieja%d?mode=memory&cache=shared", rand.Int())), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.NoError(err, "Debería conectarse a la base de datos")
+	db.Exec("CREATE TABLE `participantes` (`id` integer PRIMARY KEY AUTOINCREMENT,`amigx_id` integer,`nombre` text)")
+	db.Exec("INSERT INTO participantes (id, amigx_id, nombre) VALUES (1, 2, 'Nick'), (2, NULL, 'Nay')")
+
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "No debería fallar al migrar")
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "Migrar dos veces no debería cambiar nada")
+
+	suite.False(db.Migrator().HasColumn(&modelo.Participante{}, "amigx_id"), "Debería borrar la columna vieja")
+	regalos := make([]*modelo.Regalo, 0)
+	db.Find(&regalos)
+	suite.Len(regalos, 1, "Debería copiar el amigx una sola vez")
+	suite.Equal(uint(1), regalos[0].DeID, "Nick debería seguir regalando")
+	suite.Equal(uint(2), *regalos[0].ParaID, "Nick debería seguir regalándole a Nay")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaPasaLasAsignacionesViejasARegalos() {
+	db := suite.baseAparte()
+	db.Exec("CREATE TABLE asignaciones (de_id integer, para_id integer)")
+	db.Exec("INSERT INTO asignaciones (de_id, para_id) VALUES (1, 2), (2, 1)")
+
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "No debería fallar al migrar")
+	suite.NoError(lamaga.PrepararBaseDeDatos(db), "Migrar dos veces no debería cambiar nada")
+
+	suite.False(db.Migrator().HasTable("asignaciones"), "Debería borrar la tabla vieja")
+	var regalos int64
+	db.Model(&modelo.Regalo{}).Count(&regalos)
+	suite.Equal(int64(2), regalos, "Debería copiar las asignaciones una sola vez")
+}
+
+func (suite *LaMagaTestSuite) claves(identificadores ...string) string {
+	claves := ""
+	for _, identificador := range identificadores {
+		clave, err := cifrado.NuevaClave()
+		suite.NoError(err, "No debería fallar al crear una clave")
+		claves += identificador + ":" + clave + ","
+	}
+	return claves
+}
+
+func (suite *LaMagaTestSuite) magaCifrada(db *gorm.DB, claves string) *lamaga.LaMaga {
+	cifrador, err := cifrado.NewCifrador(claves)
+	suite.NoError(err, "No debería fallar al crear el cifrador")
+	return lamaga.NewMagaCifrada(db, cifrador)
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaCifradaNoGuardaAQuienLeRegalaCadaUne() {
+	db := suite.baseAparte()
+	maga := suite.magaCifrada(db, suite.claves("1"))
+	IDNuevoGrupo := int64(rand.Int())
+	maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	IDNay := rand.Int()
+	maga.NuevoParticipante(IDNuevoGrupo, "", IDNay, "Nay")
+	sorteados, err := maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear")
+
+	regalo := modelo.Regalo{}
+	db.Where("de_id = ?", sorteados[0].ID).First(&regalo)
+	suite.Nil(regalo.ParaID, "No debería guardarse a quién le regala")
+	suite.True(cifrado.EstaCifrado(regalo.ParaCifrado), "Debería guardarse cifrado")
+	grupoDeLaDB := modelo.Grupo{}
+	db.First(&grupoDeLaDB, sorteados[0].GrupoID)
+	suite.True(cifrado.EstaCifrado(grupoDeLaDB.Acta), "El acta debería guardarse cifrada")
+
+	participantes, err := maga.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería fallar al buscar participantes y amigxs")
+	suite.Equal("Nay", participantes[0].Amigxs[0].Nombre, "Nay debería ser amiga de Nick")
+	suite.Equal("Nick", participantes[1].Amigxs[0].Nombre, "Nick debería ser amigo de Nay")
+
+	grupoAmigx, err := maga.AmigxsDe(IDNay)
+	suite.NoError(err, "No debería fallar al buscar los amigxs")
+	suite.Len(grupoAmigx, 1, "Nay debería tener un amigx")
+	suite.Equal("Nick", grupoAmigx[0].Amigx, "Nick debería ser amigo de Nay")
+
+	grupo, err := maga.Juego(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería fallar al buscar el juego")
+	suite.Equal(sorteo.Compromiso([]byte(grupo.Acta)), grupo.Compromiso, "Debería descifrar el acta")
+
+	_, err = lamaga.NewMaga(db).ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.EqualError(err, "faltanClaves", "Sin las claves no debería poder ver los amigxs")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaCifradaRotaLasClaves() {
+	db := suite.baseAparte()
+	maga := lamaga.NewMaga(db)
+	IDNuevoGrupo := int64(rand.Int())
+	maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	for _, nombre := range []string{"Nick", "Nay", "Juli"} {
+		maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), nombre)
+	}
+	sorteados, err := maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al sortear")
+
+	clavesViejas := suite.claves("1")
+	cambiados, err := suite.magaCifrada(db, clavesViejas).Recifrar()
+	suite.NoError(err, "No debería fallar al cifrar")
+	suite.Equal(4, cambiados, "Debería cifrar los tres regalos y el acta")
+
+	clavesNuevas := suite.claves("2")
+	cambiados, err = suite.magaCifrada(db, clavesNuevas+clavesViejas).Recifrar()
+	suite.NoError(err, "No debería fallar al recifrar")
+	suite.Equal(4, cambiados, "Debería recifrar todo con la clave nueva")
+
+	conLaClaveNueva := suite.magaCifrada(db, clavesNuevas)
+	cambiados, err = conLaClaveNueva.Recifrar()
+	suite.NoError(err, "No debería fallar al recifrar")
+	suite.Equal(0, cambiados, "No debería quedar nada con la clave vieja")
+	participantes, err := conLaClaveNueva.ParticipantesConAmigxs(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería necesitar la clave vieja")
+	for i, participante := range participantes {
+		suite.Equal(sorteados[i].Amigxs[0].ID, participante.Amigxs[0].ID, "Debería seguir teniendo el mismo amigx")
+	}
+	grupo, err := conLaClaveNueva.Juego(IDNuevoGrupo, "")
+	suite.NoError(err, "No debería fallar al descifrar el acta")
+	suite.Equal(sorteo.Compromiso([]byte(grupo.Acta)), grupo.Compromiso, "El acta debería ser la misma")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaCuentaLosSorteosYMideLaBaseDeDatos() {
+	db := suite.baseAparte()
+	suite.NoError(lamaga.MedirBaseDeDatos(db), "No debería fallar al medir la base de datos")
+	maga := lamaga.NewMaga(db)
+	sorteosAntes := testutil.ToFloat64(metricas.Sorteos.WithLabelValues("ok"))
+	imposiblesAntes := testutil.ToFloat64(metricas.Sorteos.WithLabelValues("faltanParticipantes"))
+
+	IDNuevoGrupo := int64(rand.Int())
+	maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nay")
+	maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.Equal(sorteosAntes+1, testutil.ToFloat64(metricas.Sorteos.WithLabelValues("ok")), "Debería contar el sorteo")
+	suite.Equal(imposiblesAntes+1, testutil.ToFloat64(metricas.Sorteos.WithLabelValues("faltanParticipantes")), "Debería contar el sorteo que falló")
+	suite.Greater(testutil.CollectAndCount(metricas.LatenciaDeLaBaseDeDatos), 0, "Debería medir las consultas")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaResumeLosJuegosSinMostrarLosRegalos() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.Notificado(participantes[0])
+
+	resumenes, err := suite.maga.ResumenDeJuegos()
+	suite.NoError(err, "No debería fallar al resumir los juegos")
+	var resumen *lamaga.ResumenDeJuego
+	for i := range resumenes {
+		if resumenes[i].Grupo.Identificador == IDNuevoGrupo {
+			resumen = &resumenes[i]
+		}
+	}
+	suite.NotNil(resumen, "Debería estar el juego nuevo")
+	suite.Equal(3, resumen.Participantes, "Debería contar a las personas")
+	suite.Equal(2, resumen.SinNotificar, "Debería contar a quienes falta avisarles")
+	suite.Empty(resumen.Grupo.Acta, "No debería mostrar el acta")
+
+	resumenDelJuego, err := suite.maga.ResumenDelJuego(resumen.Grupo.ID)
+	suite.NoError(err, "No debería fallar al resumir el juego")
+	suite.Empty(resumenDelJuego.Grupo.Acta, "No debería mostrar el acta")
+	for _, participante := range resumenDelJuego.Grupo.Participantes {
+		suite.Empty(participante.Amigxs, "No debería mostrar los regalos")
+	}
+
+	_, err = suite.maga.ResumenDelJuego(0)
+	suite.EqualError(err, "noExisteElJuego", "No debería encontrar un juego que no existe")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaSoloMuestraLosRegalosForzandoYLoDejaEnLaBitacora() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay")
+	salida := &bytes.Buffer{}
+	suite.maga.UsarBitacora(bitacora.New(salida, bitacora.Informacion, false))
+
+	conAmigxs, err := suite.maga.AmigxsDelJuego(participantes[0].GrupoID, 42)
+
+	suite.NoError(err, "No debería fallar al buscar los regalos")
+	suite.Equal(conAmigxs[1].Nombre, conAmigxs[0].Amigxs[0].Nombre, "Cada une debería regalarle a le otre")
+	suite.Contains(salida.String(), `"administrador":42`, "Debería quedar en la bitácora quién los pidió")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaLogueaConLaBitacoraDelPedido() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nay")
+	salidaDelBot := &bytes.Buffer{}
+	maga := lamaga.NewMaga(suite.db)
+	maga.UsarBitacora(bitacora.New(salidaDelBot, bitacora.Informacion, false))
+	salidaDelPedido := &bytes.Buffer{}
+
+	_, err := maga.ConBitacora(bitacora.New(salidaDelPedido, bitacora.Informacion, false).Con("actualizacion", 77)).Sortear(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al sortear")
+	suite.Contains(salidaDelPedido.String(), `"actualizacion":77`, "El sorteo debería loguearse con los datos del pedido")
+	suite.Contains(salidaDelPedido.String(), "Sorteo hecho", "Debería loguear el sorteo")
+	suite.Empty(salidaDelBot.String(), "No debería cambiar la bitácora de La Maga")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaLasNotificacionesDeUnJuegoParaReenviar() {
+	IDNuevoGrupo := int64(rand.Int())
+	participantes := suite.grupoSorteadoEnCadena(IDNuevoGrupo, "Nick", "Nay", "Juli")
+	suite.maga.SeFue(IDNuevoGrupo, participantes[2].Identificador)
+
+	notificaciones, err := suite.maga.NotificacionesDelJuego(participantes[0].GrupoID, IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al buscar las notificaciones")
+	suite.Len(notificaciones, 2, "No debería avisarle a quien se fue")
+	for _, notificacion := range notificaciones {
+		suite.Len(notificacion.Participante.Amigxs, 1, "Debería tener su amigx")
+	}
+
+	IDSinSortear := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDSinSortear, "", "Mi grupo", IDOrganizador)
+	grupo, _ := suite.maga.Juego(IDSinSortear, "")
+	_, err = suite.maga.NotificacionesDelJuego(grupo.ID, IDOrganizador)
+	suite.EqualError(err, "noSorteado", "No debería reenviar si no sorteó")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaTeDaLasCuentasQueJueganSinRepetir() {
+	db := suite.baseAparte()
+	maga := lamaga.NewMaga(db)
+	for _, identificador := range []int64{1, 2} {
+		maga.NuevoGrupo(identificador, "", "Mi grupo", IDOrganizador)
+		maga.NuevoParticipante(identificador, "", 10, "Nick")
+		maga.NuevoParticipante(identificador, "", 20+int(identificador), "Nay")
+	}
+	maga.NuevoParticipanteSinTelegram(1, "", IDOrganizador, "Juani", "")
+	maga.NuevoGrupo(3, "", "Terminado", IDOrganizador)
+	maga.NuevoParticipante(3, "", 30, "Juli")
+	maga.Archivar(3, "", IDOrganizador)
+
+	cuentas, err := maga.CuentasQueJuegan()
+
+	suite.NoError(err, "No debería fallar al buscar las cuentas")
+	suite.Equal([]int{10, 21, 22, IDOrganizador}, cuentas, "Debería tener cada cuenta una vez y no las de juegos terminados")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaAnotaTodoLoQuePasaEnElJuego() {
+	IDNuevoGrupo := int64(rand.Int())
+	IDNay := rand.Int()
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDOrganizador, "Nick")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNay, "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", IDNay, "Nay")
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Juli")
+	suite.maga.NuevoParticipanteSinTelegram(IDNuevoGrupo, "", IDOrganizador, "Juani", "")
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Renotificar(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Compro(IDNuevoGrupo, "", IDNay)
+	suite.maga.SeFue(IDNuevoGrupo, IDNay)
+
+	eventos, err := suite.maga.Registro(IDNuevoGrupo, "", IDOrganizador)
+
+	suite.NoError(err, "No debería fallar al buscar el registro")
+	tipos := make([]string, 0, len(eventos))
+	for _, evento := range eventos {
+		tipos = append(tipos, evento.Tipo)
+		suite.False(evento.Momento.IsZero(), "Cada evento debería tener su momento")
+	}
+	suite.Equal([]string{
+		modelo.EventoCreado, modelo.EventoSumado, modelo.EventoSumado, modelo.EventoSumado, modelo.EventoSumado,
+		modelo.EventoSorteado, modelo.EventoRenotificado, modelo.EventoCompro, modelo.EventoSeFue,
+	}, tipos, "Debería anotar cada cambio una vez y en orden")
+	suite.Equal(IDNay, eventos[2].Cuenta, "Debería anotar quién se sumó")
+	suite.Equal("Nay", eventos[2].Quien, "Debería tener el nombre de quien se sumó")
+	suite.Equal("Nick", eventos[4].Quien, "Debería tener el nombre de quien sumó a Juani")
+	suite.Equal("Juani", eventos[4].Sobre, "Debería tener el nombre de quien fue sumada")
+	suite.Equal("4", eventos[5].Detalle, "Debería anotar entre cuántas personas sorteó")
+
+	_, err = suite.maga.Registro(IDNuevoGrupo, "", IDNay)
+	suite.EqualError(err, "noEsOrganizador", "Sólo quien organiza debería ver el registro")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaNoAnotaLosCambiosQueFallan() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	suite.maga.NuevoParticipante(IDNuevoGrupo, "", rand.Int(), "Nick")
+
+	suite.maga.Sortear(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.DefinirEquipo(IDNuevoGrupo, "", rand.Int(), "Azul")
+
+	eventos, err := suite.maga.Registro(IDNuevoGrupo, "", IDOrganizador)
+	suite.NoError(err, "No debería fallar al buscar el registro")
+	suite.Len(eventos, 2, "Sólo deberían estar la creación y quien se sumó")
+}
+
+func (suite *LaMagaTestSuite) TestLaMagaGuardaLosEventosDeLosJuegosBorrados() {
+	IDNuevoGrupo := int64(rand.Int())
+	suite.maga.NuevoGrupo(IDNuevoGrupo, "", "Mi grupo", IDOrganizador)
+	grupo, _ := suite.maga.Juego(IDNuevoGrupo, "")
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Restaurar(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Archivar(IDNuevoGrupo, "", IDOrganizador)
+	suite.maga.Purgar(IDNuevoGrupo, "", IDOrganizador)
+
+	eventos := make([]modelo.Evento, 0)
+	suite.db.Where("grupo_id = ?", grupo.ID).Order("id").Find(&eventos)
+	tipos := make([]string, 0, len(eventos))
+	for _, evento := range eventos {
+		tipos = append(tipos, evento.Tipo)
+	}
+	suite.Equal([]string{modelo.EventoCreado, modelo.EventoTerminado, modelo.EventoRestaurado, modelo.EventoTerminado, modelo.EventoBorrado}, tipos, "Los eventos no deberían borrarse con el juego")
+}
+
 func TestLaMagaTestSuite(t *testing.T) {
 	suite.Run(t, new(LaMagaTestSuite))
 }
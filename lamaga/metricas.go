@@ -0,0 +1,49 @@
+package lamaga
+
+import (
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/metricas"
+	"gorm.io/gorm"
+)
+
+const inicioDeLaConsulta = "metricas:inicio"
+
+// Registra en gorm callbacks que miden cuánto tarda cada consulta
+func MedirBaseDeDatos(baseDeDatos *gorm.DB) error {
+	callbacks := baseDeDatos.Callback()
+	registros := []error{
+		callbacks.Create().Before("gorm:create").Register("metricas:antes_de_create", empezarConsulta),
+		callbacks.Create().After("gorm:create").Register("metricas:despues_de_create", terminarConsulta("create")),
+		callbacks.Query().Before("gorm:query").Register("metricas:antes_de_query", empezarConsulta),
+		callbacks.Query().After("gorm:query").Register("metricas:despues_de_query", terminarConsulta("query")),
+		callbacks.Update().Before("gorm:update").Register("metricas:antes_de_update", empezarConsulta),
+		callbacks.Update().After("gorm:update").Register("metricas:despues_de_update", terminarConsulta("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metricas:antes_de_delete", empezarConsulta),
+		callbacks.Delete().After("gorm:delete").Register("metricas:despues_de_delete", terminarConsulta("delete")),
+		callbacks.Row().Before("gorm:row").Register("metricas:antes_de_row", empezarConsulta),
+		callbacks.Row().After("gorm:row").Register("metricas:despues_de_row", terminarConsulta("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metricas:antes_de_raw", empezarConsulta),
+		callbacks.Raw().After("gorm:raw").Register("metricas:despues_de_raw", terminarConsulta("raw")),
+	}
+	for _, err := range registros {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func empezarConsulta(baseDeDatos *gorm.DB) {
+	baseDeDatos.InstanceSet(inicioDeLaConsulta, time.Now())
+}
+
+func terminarConsulta(operacion string) func(*gorm.DB) {
+	return func(baseDeDatos *gorm.DB) {
+		inicio, existe := baseDeDatos.InstanceGet(inicioDeLaConsulta)
+		if !existe {
+			return
+		}
+		metricas.LatenciaDeLaBaseDeDatos.WithLabelValues(operacion, baseDeDatos.Statement.Table).Observe(time.Since(inicio.(time.Time)).Seconds())
+	}
+}
@@ -0,0 +1,213 @@
+package lamaga
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nickrisaro/invisible-bot/cifrado"
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (lm *LaMaga) guardarAmigxs(tx *gorm.DB, participante *modelo.Participante) error {
+	resultado := tx.Omit(clause.Associations).Save(participante)
+	if resultado.Error != nil {
+		return resultado.Error
+	}
+
+	resultado = tx.Where("de_id = ?", participante.ID).Delete(&modelo.Regalo{})
+	if resultado.Error != nil {
+		return resultado.Error
+	}
+
+	for _, amigx := range participante.Amigxs {
+		regalo, err := lm.nuevoRegalo(participante.ID, amigx.ID)
+		if err != nil {
+			return err
+		}
+		resultado = tx.Create(regalo)
+		if resultado.Error != nil {
+			return resultado.Error
+		}
+	}
+	return nil
+}
+
+func (lm *LaMaga) cargarAmigxs(baseDeDatos *gorm.DB, participantes []*modelo.Participante) error {
+	if len(participantes) == 0 {
+		return nil
+	}
+
+	participantesPorID := make(map[uint]*modelo.Participante, len(participantes))
+	ids := make([]uint, 0, len(participantes))
+	for _, participante := range participantes {
+		participante.Amigxs = make([]*modelo.Participante, 0)
+		participantesPorID[participante.ID] = participante
+		ids = append(ids, participante.ID)
+	}
+
+	regalos := make([]modelo.Regalo, 0)
+	resultado := baseDeDatos.Where("de_id IN ?", ids).Order("id").Find(&regalos)
+	if resultado.Error != nil {
+		return resultado.Error
+	}
+
+	paraIDs := make([]uint, len(regalos))
+	for i, regalo := range regalos {
+		paraID, err := lm.paraDe(regalo)
+		if err != nil {
+			return err
+		}
+		paraIDs[i] = paraID
+	}
+
+	amigxsPorID := make(map[uint]*modelo.Participante)
+	if len(paraIDs) > 0 {
+		amigxs := make([]*modelo.Participante, 0)
+		resultado = baseDeDatos.Where("id IN ?", paraIDs).Find(&amigxs)
+		if resultado.Error != nil {
+			return resultado.Error
+		}
+		for _, amigx := range amigxs {
+			amigxsPorID[amigx.ID] = amigx
+		}
+	}
+
+	for i, regalo := range regalos {
+		amigx, existe := amigxsPorID[paraIDs[i]]
+		if !existe {
+			continue
+		}
+		participante := participantesPorID[regalo.DeID]
+		participante.Amigxs = append(participante.Amigxs, amigx)
+	}
+	return nil
+}
+
+func (lm *LaMaga) nuevoRegalo(de uint, para uint) (*modelo.Regalo, error) {
+	if lm.cifrador == nil {
+		return &modelo.Regalo{DeID: de, ParaID: &para}, nil
+	}
+
+	paraCifrado, err := lm.cifrador.Cifrar([]byte(strconv.FormatUint(uint64(para), 10)), contextoDeRegalo(de))
+	if err != nil {
+		return nil, err
+	}
+	return &modelo.Regalo{DeID: de, ParaCifrado: paraCifrado}, nil
+}
+
+func (lm *LaMaga) paraDe(regalo modelo.Regalo) (uint, error) {
+	if regalo.ParaID != nil {
+		return *regalo.ParaID, nil
+	}
+	if lm.cifrador == nil {
+		return 0, errors.New("faltanClaves")
+	}
+
+	texto, err := lm.cifrador.Descifrar(regalo.ParaCifrado, contextoDeRegalo(regalo.DeID))
+	if err != nil {
+		return 0, err
+	}
+	paraID, err := strconv.ParseUint(string(texto), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(paraID), nil
+}
+
+func (lm *LaMaga) cifrarActa(grupoID uint, acta string) (string, error) {
+	if lm.cifrador == nil || len(acta) == 0 {
+		return acta, nil
+	}
+	return lm.cifrador.Cifrar([]byte(acta), contextoDeActa(grupoID))
+}
+
+func (lm *LaMaga) descifrarActa(grupo *modelo.Grupo) (string, error) {
+	if !cifrado.EstaCifrado(grupo.Acta) {
+		return grupo.Acta, nil
+	}
+	if lm.cifrador == nil {
+		return "", errors.New("faltanClaves")
+	}
+
+	texto, err := lm.cifrador.Descifrar(grupo.Acta, contextoDeActa(grupo.ID))
+	if err != nil {
+		return "", err
+	}
+	return string(texto), nil
+}
+
+// Vuelve a cifrar con la clave actual los regalos y las actas que estaban
+// sin cifrar o con una clave vieja. Devuelve cuántos cambió
+func (lm *LaMaga) Recifrar() (int, error) {
+	if lm.cifrador == nil {
+		return 0, errors.New("faltanClaves")
+	}
+
+	cambiados := 0
+	regalos := make([]modelo.Regalo, 0)
+	resultado := lm.miBaseDeDatos.Order("id").Find(&regalos)
+	if resultado.Error != nil {
+		return 0, resultado.Error
+	}
+	for _, regalo := range regalos {
+		if regalo.ParaID == nil && lm.cifrador.ConClaveActual(regalo.ParaCifrado) {
+			continue
+		}
+
+		paraID, err := lm.paraDe(regalo)
+		if err != nil {
+			return cambiados, err
+		}
+		recifrado, err := lm.nuevoRegalo(regalo.DeID, paraID)
+		if err != nil {
+			return cambiados, err
+		}
+		resultado := lm.miBaseDeDatos.Model(&regalo).
+			Select("para_id", "para_cifrado").
+			Updates(map[string]interface{}{"para_id": nil, "para_cifrado": recifrado.ParaCifrado})
+		if resultado.Error != nil {
+			return cambiados, resultado.Error
+		}
+		cambiados++
+	}
+
+	grupos := make([]*modelo.Grupo, 0)
+	resultado = lm.miBaseDeDatos.Unscoped().Where("acta <> ''").Order("id").Find(&grupos)
+	if resultado.Error != nil {
+		return cambiados, resultado.Error
+	}
+	for _, grupo := range grupos {
+		if lm.cifrador.ConClaveActual(grupo.Acta) {
+			continue
+		}
+
+		acta, err := lm.descifrarActa(grupo)
+		if err != nil {
+			return cambiados, err
+		}
+		recifrada, err := lm.cifrarActa(grupo.ID, acta)
+		if err != nil {
+			return cambiados, err
+		}
+		resultado := lm.miBaseDeDatos.Unscoped().Model(grupo).Update("acta", recifrada)
+		if resultado.Error != nil {
+			return cambiados, resultado.Error
+		}
+		cambiados++
+	}
+
+	lm.registro.Con("cambiados", cambiados).Informar("Regalos y actas recifrados con la clave actual")
+	return cambiados, nil
+}
+
+// El contexto ata cada valor cifrado a su fila, así no se puede copiar de una a otra
+func contextoDeRegalo(de uint) string {
+	return fmt.Sprintf("regalo:%d", de)
+}
+
+func contextoDeActa(grupoID uint) string {
+	return fmt.Sprintf("acta:%d", grupoID)
+}
@@ -1,68 +1,160 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/nickrisaro/invisible-bot/api"
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/cifrado"
+	"github.com/nickrisaro/invisible-bot/config"
 	"github.com/nickrisaro/invisible-bot/lamaga"
-	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/metricas"
+	"github.com/nickrisaro/invisible-bot/pagina"
+	"github.com/nickrisaro/invisible-bot/servidor"
 	"github.com/nickrisaro/invisible-bot/telegram"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const EsperaParaCerrar = 25 * time.Second
+
 func main() {
-	log.Print("Iniciando invisible-bot")
+	configuracion, err := config.Cargar(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(config.Uso())
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "La configuración no es válida:", err)
+		os.Exit(1)
+	}
 
-	host := os.Getenv("HOST")
-	port := os.Getenv("PORT")
-	token := os.Getenv("TELEGRAM_API_TOKEN")
-	urlPublica := os.Getenv("APP_URL")
-	urlDB := os.Getenv("DATABASE_URL")
+	registro := configuracion.Bitacora(os.Stdout)
+	registro.Con("modo", configuracion.Modo).Informar("Iniciando invisible-bot")
 
-	if host == "" {
-		log.Print("Usando host default")
-		host = "0.0.0.0"
+	db, err := gorm.Open(postgres.Open(configuracion.URLBaseDeDatos), &gorm.Config{})
+	if err != nil {
+		terminar(registro, "No pude conectarme a la base de datos", err)
+		return
 	}
-
-	if port == "" {
-		log.Print("Usando port default")
-		port = "3000"
+	err = lamaga.MedirBaseDeDatos(db)
+	if err != nil {
+		terminar(registro, "No pude medir la base de datos", err)
+		return
 	}
-
-	if token == "" {
-		log.Fatal("Se debe setear la variable TELEGRAM_API_TOKEN")
+	err = lamaga.PrepararBaseDeDatos(db)
+	if err != nil {
+		terminar(registro, "No pude migrar las tablas", err)
 		return
 	}
 
-	if urlPublica == "" {
-		log.Fatal("Se debe setear la variable APP_URL")
+	claves, err := configuracion.Claves()
+	if err != nil {
+		terminar(registro, "No pude leer el archivo de claves", err)
 		return
 	}
 
-	if urlDB == "" {
-		log.Fatal("Se debe setear la variable DATABASE_URL")
-		return
+	maga := lamaga.NewMaga(db)
+	maga.UsarBitacora(registro)
+	if claves != "" {
+		cifrador, err := cifrado.NewCifrador(claves)
+		if err != nil {
+			terminar(registro, "Las claves de cifrado no son válidas", err)
+			return
+		}
+		maga = lamaga.NewMagaCifrada(db, cifrador)
+		maga.UsarBitacora(registro)
+
+		recifrados, err := maga.Recifrar()
+		if err != nil {
+			terminar(registro, "No pude cifrar los regalos", err)
+			return
+		}
+		registro.Con("recifrados", recifrados).Informar("Regalos y actas cifrados con la clave actual")
 	}
 
-	db, err := gorm.Open(postgres.Open(urlDB), &gorm.Config{})
+	baseDeDatos, err := db.DB()
 	if err != nil {
-		log.Fatal("No pude conectarme a la base de datos", err)
+		terminar(registro, "No pude obtener la conexión a la base de datos", err)
 		return
 	}
-	db.AutoMigrate(&modelo.Grupo{}, &modelo.Participante{})
+
+	var enlaces *pagina.Firmador
+	if configuracion.ClaveDeLosEnlaces != "" {
+		enlaces, err = pagina.NewFirmador(configuracion.ClaveDeLosEnlaces, configuracion.VigenciaDeLosEnlaces, configuracion.URLPublica)
+		if err != nil {
+			terminar(registro, "No pude preparar los enlaces a la página de amigxs", err)
+			return
+		}
+	}
+
+	b, err := telegram.Configurar(configuracion, maga, enlaces, registro)
 	if err != nil {
-		log.Fatal("No pude migrar las tablas", err)
+		terminar(registro, "No pude iniciar el bot", err)
 		return
 	}
 
-	b, err := telegram.Configurar(urlPublica, fmt.Sprintf("%s:%s", host, port), token, lamaga.NewMaga(db))
+	servidorHTTP := servidor.NewServidor(configuracion.DireccionPrivada(), baseDeDatos.PingContext, registro)
+	if configuracion.TokenDeLasMetricas != "" {
+		servidorHTTP.Manejar("/metrics", metricas.Manejador(configuracion.TokenDeLasMetricas))
+	}
+	if configuracion.TokenDeLaAPI != "" {
+		servidorHTTP.Manejar(api.Prefijo, api.NewAPI(maga, configuracion.TokenDeLaAPI, b, registro))
+	}
+	if enlaces != nil {
+		servidorHTTP.Manejar(pagina.Ruta, pagina.NewPagina(maga, enlaces, registro))
+	}
+	if b.Webhook() != nil {
+		servidorHTTP.Manejar("/", b.Webhook())
+	}
+
+	go func() {
+		err := servidorHTTP.Iniciar()
+		if err != nil {
+			terminar(registro, "No pude iniciar el servidor", err)
+		}
+	}()
+	go b.Start()
+
+	if configuracion.Modo == config.ModoPolling {
+		registro.Con("intervalo", configuracion.IntervaloDePolling.String()).Con("direccion", configuracion.DireccionPrivada()).Informar("Pidiendo actualizaciones a Telegram")
+	} else {
+		registro.Con("url", configuracion.URLPublica).Con("direccion", configuracion.DireccionPrivada()).Informar("Webhook escuchando")
+	}
+
+	señales := make(chan os.Signal, 1)
+	signal.Notify(señales, syscall.SIGTERM, syscall.SIGINT)
+	<-señales
+	registro.Informar("Cerrando invisible-bot")
+
+	// Heroku da 30 segundos entre SIGTERM y SIGKILL
+	ctx, cancelar := context.WithTimeout(context.Background(), EsperaParaCerrar)
+	defer cancelar()
+
+	servidorHTTP.Cerrando()
+	err = b.Detener(ctx)
 	if err != nil {
-		log.Fatal("No pude iniciar el bot", err)
-		return
+		registro.Advertir("No se terminaron de mandar todos los mensajes", err)
+	}
+	err = servidorHTTP.Cerrar(ctx)
+	if err != nil {
+		registro.Advertir("No pude cerrar el servidor", err)
+	}
+	err = baseDeDatos.Close()
+	if err != nil {
+		registro.Advertir("No pude cerrar la base de datos", err)
 	}
+	registro.Informar("Listo, chau")
+}
 
-	log.Printf("Webhook escuchando en %s -> %s:%s", urlPublica, host, port)
-	b.Start()
+func terminar(registro *bitacora.Bitacora, mensaje string, err error) {
+	registro.Error(mensaje, err)
+	os.Exit(1)
 }
@@ -0,0 +1,78 @@
+package metricas
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const espacio = "invisible_bot"
+
+var (
+	Comandos = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "comandos_total",
+		Help:      "Comandos atendidos por nombre y resultado",
+	}, []string{"comando", "resultado"})
+
+	Sorteos = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "sorteos_total",
+		Help:      "Sorteos pedidos por resultado",
+	}, []string{"resultado"})
+
+	Notificaciones = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: espacio,
+		Name:      "notificaciones_total",
+		Help:      "Mensajes privados con amigxs por resultado",
+	}, []string{"resultado"})
+
+	LatenciaDeTelegram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: espacio,
+		Name:      "telegram_api_duracion_segundos",
+		Help:      "Duración de los pedidos a la API de Telegram por método",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"metodo", "resultado"})
+
+	LatenciaDeLaBaseDeDatos = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: espacio,
+		Name:      "base_de_datos_duracion_segundos",
+		Help:      "Duración de las consultas a la base de datos por operación y tabla",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operacion", "tabla"})
+)
+
+// Los errores de La Maga tienen nombres como noEsOrganizador, el resto se
+// agrupa para no llenar las métricas de etiquetas distintas
+var nombreDeError = regexp.MustCompile(`^[a-z][A-Za-z]{0,39}$`)
+
+func Resultado(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if nombreDeError.MatchString(err.Error()) {
+		return err.Error()
+	}
+	return "error"
+}
+
+// Las métricas dicen cuántos juegos y personas hay, así que sólo se muestran
+// a quien mande el token en Authorization: Bearer <token>
+func Manejador(token string) http.Handler {
+	metricas := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encabezado := r.Header.Get("Authorization")
+		if !strings.HasPrefix(encabezado, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(encabezado, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "noAutorizado", http.StatusUnauthorized)
+			return
+		}
+		metricas.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package metricas_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/metricas"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const tokenDePrueba = "un-token-para-leer-las-metricas-de-prueba"
+
+func TestElResultadoUsaElNombreDelError(t *testing.T) {
+	assert.Equal(t, "ok", metricas.Resultado(nil), "Sin error debería ser ok")
+	assert.Equal(t, "noEsOrganizador", metricas.Resultado(errors.New("noEsOrganizador")), "Debería usar el nombre del error")
+	assert.Equal(t, "error", metricas.Resultado(errors.New("pq: connection refused")), "Los demás errores deberían agruparse")
+}
+
+func TestLasMetricasSePublicanEnFormatoPrometheus(t *testing.T) {
+	antes := testutil.ToFloat64(metricas.Comandos.WithLabelValues("/ping", "ok"))
+	metricas.Comandos.WithLabelValues("/ping", "ok").Inc()
+
+	pedido := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	pedido.Header.Set("Authorization", "Bearer "+tokenDePrueba)
+	respuesta := httptest.NewRecorder()
+	metricas.Manejador(tokenDePrueba).ServeHTTP(respuesta, pedido)
+
+	assert.Equal(t, http.StatusOK, respuesta.Code, "Debería publicar las métricas")
+	assert.Equal(t, antes+1, testutil.ToFloat64(metricas.Comandos.WithLabelValues("/ping", "ok")), "Debería contar los comandos")
+	assert.Contains(t, respuesta.Body.String(), `invisible_bot_comandos_total{comando="/ping",resultado="ok"}`, "Debería publicar los comandos")
+}
+
+func TestLasMetricasPidenElToken(t *testing.T) {
+	for _, encabezado := range []string{"", "Bearer otro-token", tokenDePrueba} {
+		pedido := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		pedido.Header.Set("Authorization", encabezado)
+		respuesta := httptest.NewRecorder()
+		metricas.Manejador(tokenDePrueba).ServeHTTP(respuesta, pedido)
+
+		assert.Equal(t, http.StatusUnauthorized, respuesta.Code, "No debería publicar las métricas con %q", encabezado)
+		assert.NotContains(t, respuesta.Body.String(), "invisible_bot_", "No debería mostrar ninguna métrica")
+	}
+}
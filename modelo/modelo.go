@@ -1,11 +1,64 @@
 package modelo
 
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NotificacionPendiente = "pendiente"
+	NotificacionEnviada   = "enviada"
+	NotificacionFallida   = "fallida"
+	NotificacionEnviando  = "enviando"
+
+	MaximoDeIntentos    = 8
+	EsperaEntreIntentos = time.Minute
+
+	EquiposSinRegla  = ""
+	EquiposDistintos = "distintos"
+	MismoEquipo      = "mismo"
+
+	EventoCreado            = "creado"
+	EventoSumado            = "sumado"
+	EventoSeFue             = "seFue"
+	EventoEquipo            = "equipo"
+	EventoReglaDeEquipos    = "reglaDeEquipos"
+	EventoHermanxs          = "hermanxs"
+	EventoRegalosPorPersona = "regalosPorPersona"
+	EventoSorteado          = "sorteado"
+	EventoRenotificado      = "renotificado"
+	EventoReenlazado        = "reenlazado"
+	EventoFecha             = "fecha"
+	EventoPresupuesto       = "presupuesto"
+	EventoDeseos            = "deseos"
+	EventoCompro            = "compro"
+	EventoRecibio           = "recibio"
+	EventoAdivino           = "adivino"
+	EventoRevelado          = "revelado"
+	EventoTerminado         = "terminado"
+	EventoRestaurado        = "restaurado"
+	EventoBorrado           = "borrado"
+)
+
 type Grupo struct {
-	ID            uint
-	Identificador int64 `gorm:"unique"`
-	Nombre        string
-	Participantes []*Participante
-	YaSorteo      bool
+	ID                uint
+	Identificador     int64  `gorm:"uniqueIndex:idx_grupos_juego_activo,where:archivado_en IS NULL"`
+	Juego             string `gorm:"uniqueIndex:idx_grupos_juego_activo,where:archivado_en IS NULL;default:''"`
+	Nombre            string
+	Participantes     []*Participante
+	YaSorteo          bool
+	Organizador       int
+	Fecha             *time.Time
+	Presupuesto       string
+	Revelado          bool
+	ReglaDeEquipos    string
+	RegalosPorPersona int `gorm:"default:1"`
+	HermanxsSeRegalan bool
+	Acta              string
+	Compromiso        string
+	ArchivadoEn       gorm.DeletedAt
 }
 
 type Participante struct {
@@ -13,8 +66,45 @@ type Participante struct {
 	GrupoID       uint
 	Identificador int
 	Nombre        string
-	AmigxID       *uint
-	Amigx         *Participante `gorm:"<-:update"`
+	Usuario       string
+	PrimerNombre  string
+	Apellido      string
+	Responsable   int
+	Equipo        string
+	SeFue         bool
+	Compro        bool
+	Recibio       bool
+	Deseos        string
+	Amigxs        []*Participante `gorm:"-"`
+	AdivinanzaID  *uint
+	Notificacion  EstadoNotificacion `gorm:"embedded;embeddedPrefix:notificacion_"`
+}
+
+// Si se cifran los regalos ParaID queda vacío y a quién se regala va en ParaCifrado
+type Regalo struct {
+	ID          uint
+	DeID        uint `gorm:"index"`
+	ParaID      *uint
+	ParaCifrado string
+}
+
+// Los eventos de un juego sólo se agregan, nunca se cambian ni se borran.
+// Cuenta es quien hizo algo y Participante a quien le pasó, si no fue a sí misma
+type Evento struct {
+	ID             uint
+	GrupoID        uint `gorm:"index"`
+	Tipo           string
+	Cuenta         int
+	ParticipanteID *uint
+	Detalle        string
+	Momento        time.Time
+}
+
+type EstadoNotificacion struct {
+	Estado         string
+	Motivo         string
+	Intentos       int
+	ProximoIntento *time.Time
 }
 
 func NewGrupo(identificador int64, nombre string) *Grupo {
@@ -25,11 +115,45 @@ func NewParticipante(identificador int, nombre string) *Participante {
 	return &Participante{Identificador: identificador, Nombre: nombre}
 }
 
+// Para quienes no tienen Telegram los mensajes le llegan a su responsable
+func NewParticipanteSinTelegram(nombre string, responsable int) *Participante {
+	return &Participante{Nombre: nombre, Responsable: responsable}
+}
+
+func NombreCompleto(primerNombre string, apellido string) string {
+	return strings.TrimSpace(primerNombre + " " + apellido)
+}
+
+func (p *Participante) ActualizarIdentidad(usuario string, primerNombre string, apellido string) {
+	p.Usuario = usuario
+	p.PrimerNombre = primerNombre
+	p.Apellido = apellido
+	p.Nombre = NombreCompleto(primerNombre, apellido)
+}
+
+func (g *Grupo) Titulo() string {
+	if len(g.Juego) == 0 {
+		return g.Nombre
+	}
+	return g.Nombre + " (" + g.Juego + ")"
+}
+
+func (g *Grupo) Regalos() int {
+	if g.RegalosPorPersona < 1 {
+		return 1
+	}
+	return g.RegalosPorPersona
+}
+
+func (g *Grupo) PuedeOrganizar(identificador int) bool {
+	return g.Organizador == 0 || g.Organizador == identificador
+}
+
 func (g *Grupo) Agregar(participante *Participante) {
 	enElGrupo := false
 
 	for _, participanteEnElGrupo := range g.Participantes {
-		if participanteEnElGrupo.Identificador == participante.Identificador {
+		if participanteEnElGrupo.EsLaMismaPersona(participante) {
 			enElGrupo = true
 			break
 		}
@@ -39,3 +163,106 @@ func (g *Grupo) Agregar(participante *Participante) {
 		g.Participantes = append(g.Participantes, participante)
 	}
 }
+
+func EsReglaDeEquipos(regla string) bool {
+	return regla == EquiposSinRegla || regla == EquiposDistintos || regla == MismoEquipo
+}
+
+// Quienes no tienen equipo pueden regalarle a cualquiera si los equipos tienen
+// que ser distintos, y sólo entre ellxs si tiene que ser el mismo
+func (g *Grupo) PuedeRegalar(de *Participante, a *Participante) bool {
+	if de.EsLaMismaPersona(a) {
+		return false
+	}
+	// Quienes comparten cuenta ven los mensajes de todxs, así que si se
+	// regalan entre sí se arruina la sorpresa
+	if !g.HermanxsSeRegalan && de.EsHermanx(a) {
+		return false
+	}
+	switch g.ReglaDeEquipos {
+	case EquiposDistintos:
+		return len(de.Equipo) == 0 || len(a.Equipo) == 0 || !strings.EqualFold(de.Equipo, a.Equipo)
+	case MismoEquipo:
+		return strings.EqualFold(de.Equipo, a.Equipo)
+	}
+	return true
+}
+
+func (p *Participante) TieneTelegram() bool {
+	return p.Identificador != 0
+}
+
+func (p *Participante) Destinatario() int {
+	if p.TieneTelegram() {
+		return p.Identificador
+	}
+	return p.Responsable
+}
+
+func (p *Participante) EsLaMismaPersona(otro *Participante) bool {
+	if p.TieneTelegram() || otro.TieneTelegram() {
+		return p.Identificador == otro.Identificador
+	}
+	return p.Responsable == otro.Responsable && strings.EqualFold(p.Nombre, otro.Nombre)
+}
+
+func (p *Participante) EsHermanx(otro *Participante) bool {
+	return p.Destinatario() != 0 && p.Destinatario() == otro.Destinatario() && !p.EsLaMismaPersona(otro)
+}
+
+func (p *Participante) LeRegalaA(otro *Participante) bool {
+	for _, amigx := range p.Amigxs {
+		if amigx.ID == otro.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Participante) EsQuien(nombreOUsuario string) bool {
+	nombreOUsuario = strings.TrimSpace(nombreOUsuario)
+	if strings.HasPrefix(nombreOUsuario, "@") {
+		return len(p.Usuario) > 0 && strings.EqualFold(p.Usuario, nombreOUsuario[1:])
+	}
+	return strings.EqualFold(p.Nombre, nombreOUsuario) || (len(p.Usuario) > 0 && strings.EqualFold(p.Usuario, nombreOUsuario))
+}
+
+func (p *Participante) Notificado() {
+	p.Notificacion = EstadoNotificacion{Estado: NotificacionEnviada, Intentos: p.Notificacion.Intentos + 1}
+}
+
+func (p *Participante) NoSePudoNotificar(motivo string, ahora time.Time) {
+	intentos := p.Notificacion.Intentos + 1
+	p.Notificacion = EstadoNotificacion{Estado: NotificacionFallida, Motivo: motivo, Intentos: intentos}
+
+	if intentos < MaximoDeIntentos {
+		proximoIntento := ahora.Add(EsperaEntreIntentos << (intentos - 1))
+		p.Notificacion.ProximoIntento = &proximoIntento
+	}
+}
+
+func (p *Participante) FueNotificado() bool {
+	return p.Notificacion.Estado == NotificacionEnviada
+}
+
+func EnCadena(participantes []*Participante) []*Participante {
+	participantesPorID := make(map[uint]*Participante, len(participantes))
+	for _, participante := range participantes {
+		participantesPorID[participante.ID] = participante
+	}
+
+	visitados := make(map[uint]bool, len(participantes))
+	enCadena := make([]*Participante, 0, len(participantes))
+	for _, participante := range participantes {
+		for actual := participante; actual != nil && !visitados[actual.ID]; {
+			visitados[actual.ID] = true
+			enCadena = append(enCadena, actual)
+			if len(actual.Amigxs) == 0 {
+				break
+			}
+			actual = participantesPorID[actual.Amigxs[0].ID]
+		}
+	}
+
+	return enCadena
+}
@@ -2,6 +2,7 @@ package modelo_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/nickrisaro/invisible-bot/modelo"
 	"github.com/stretchr/testify/assert"
@@ -23,7 +24,7 @@ func TestSePuedeCrearUnParticipante(t *testing.T) {
 	assert.NotNil(t, p, "El particpante no debería ser nil")
 	assert.Equal(t, 123, p.Identificador, "No tiene el identificador correcto")
 	assert.Equal(t, "Nick Risaro", p.Nombre, "No tiene el nombre correcto")
-	assert.Nil(t, p.Amigx, "No debería tener un amigx aún")
+	assert.Empty(t, p.Amigxs, "No debería tener amigxs aún")
 }
 
 func TestSePuedeAgregarUnParticipanteAUnGrupo(t *testing.T) {
@@ -48,3 +49,182 @@ func TestNoSePuedeAgregarDosVecesUnParticipanteAUnGrupo(t *testing.T) {
 	assert.Len(t, g.Participantes, 1, "Debería haber un único participante")
 	assert.Equal(t, p, g.Participantes[0], "Nick debería estar en el grupo")
 }
+
+func TestUnParticipanteNotificadoNoTieneReintentos(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick Risaro")
+
+	p.Notificado()
+
+	assert.True(t, p.FueNotificado(), "Debería estar notificado")
+	assert.Equal(t, modelo.NotificacionEnviada, p.Notificacion.Estado, "No tiene el estado correcto")
+	assert.Nil(t, p.Notificacion.ProximoIntento, "No debería tener un próximo intento")
+}
+
+func TestUnParticipanteQueNoSePudoNotificarSeReintentaMasTarde(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick Risaro")
+	ahora := time.Now()
+
+	p.NoSePudoNotificar("bot bloqueado", ahora)
+	p.NoSePudoNotificar("bot bloqueado", ahora)
+
+	assert.False(t, p.FueNotificado(), "No debería estar notificado")
+	assert.Equal(t, modelo.NotificacionFallida, p.Notificacion.Estado, "No tiene el estado correcto")
+	assert.Equal(t, "bot bloqueado", p.Notificacion.Motivo, "No tiene el motivo correcto")
+	assert.Equal(t, 2, p.Notificacion.Intentos, "No tiene la cantidad de intentos correcta")
+	assert.Equal(t, ahora.Add(2*modelo.EsperaEntreIntentos), *p.Notificacion.ProximoIntento, "La espera debería duplicarse")
+}
+
+func TestUnParticipanteNoSeReintentaMasDelMaximo(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick Risaro")
+
+	for i := 0; i < modelo.MaximoDeIntentos; i++ {
+		p.NoSePudoNotificar("bot bloqueado", time.Now())
+	}
+
+	assert.Equal(t, modelo.MaximoDeIntentos, p.Notificacion.Intentos, "No tiene la cantidad de intentos correcta")
+	assert.Nil(t, p.Notificacion.ProximoIntento, "No debería tener un próximo intento")
+}
+
+func TestSePuedeActualizarLaIdentidadDeUnParticipante(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick")
+
+	p.ActualizarIdentidad("nickrisaro", "Nick", "Risaro")
+
+	assert.Equal(t, "nickrisaro", p.Usuario, "No tiene el usuario correcto")
+	assert.Equal(t, "Nick", p.PrimerNombre, "No tiene el primer nombre correcto")
+	assert.Equal(t, "Risaro", p.Apellido, "No tiene el apellido correcto")
+	assert.Equal(t, "Nick Risaro", p.Nombre, "No tiene el nombre correcto")
+}
+
+func TestUnParticipanteSinApellidoNoTieneEspaciosDeMas(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick")
+
+	p.ActualizarIdentidad("", "Nick", "")
+
+	assert.Equal(t, "Nick", p.Nombre, "No tiene el nombre correcto")
+}
+
+func TestElTituloDeUnGrupoIncluyeElJuego(t *testing.T) {
+	g := modelo.NewGrupo(1234, "Mi grupo")
+
+	assert.Equal(t, "Mi grupo", g.Titulo(), "Sin juego el título es el nombre")
+
+	g.Juego = "Navidad 2026"
+	assert.Equal(t, "Mi grupo (Navidad 2026)", g.Titulo(), "El título debería incluir el juego")
+}
+
+func TestLosParticipantesSeOrdenanSiguiendoLaCadenaDeRegalos(t *testing.T) {
+	nick := &modelo.Participante{ID: 1, Nombre: "Nick"}
+	nay := &modelo.Participante{ID: 2, Nombre: "Nay"}
+	juli := &modelo.Participante{ID: 3, Nombre: "Juli"}
+	lu := &modelo.Participante{ID: 4, Nombre: "Lu"}
+	nick.Amigxs = []*modelo.Participante{juli}
+	nay.Amigxs = []*modelo.Participante{lu}
+	juli.Amigxs = []*modelo.Participante{nick}
+	lu.Amigxs = []*modelo.Participante{nay}
+
+	enCadena := modelo.EnCadena([]*modelo.Participante{nick, nay, juli, lu})
+
+	assert.Equal(t, []*modelo.Participante{nick, juli, nay, lu}, enCadena, "Debería seguir cada cadena hasta cerrarla")
+}
+
+func TestUnParticipanteSeReconocePorNombreOUsuario(t *testing.T) {
+	p := modelo.NewParticipante(123, "Nick")
+	p.ActualizarIdentidad("nickrisaro", "Nick", "Risaro")
+
+	assert.True(t, p.EsQuien("@NickRisaro"), "Debería reconocerse por usuario")
+	assert.True(t, p.EsQuien("nickrisaro"), "Debería reconocerse por usuario sin @")
+	assert.True(t, p.EsQuien("nick risaro"), "Debería reconocerse por nombre")
+	assert.False(t, p.EsQuien("Nick"), "No debería reconocerse por una parte del nombre")
+	assert.False(t, p.EsQuien("@"), "No debería reconocerse sin usuario")
+}
+
+func TestNadiePuedeRegalarseASiMismx(t *testing.T) {
+	grupo := modelo.NewGrupo(123, "Mi grupo")
+	participante := modelo.NewParticipante(1, "Nick")
+
+	assert.False(t, grupo.PuedeRegalar(participante, participante), "No debería poder regalarse a sí mismx")
+}
+
+func TestLasReglasDeEquipos(t *testing.T) {
+	grupo := modelo.NewGrupo(123, "Mi grupo")
+	ventas := &modelo.Participante{Identificador: 1, Equipo: "Ventas"}
+	otraDeVentas := &modelo.Participante{Identificador: 2, Equipo: "ventas"}
+	sistemas := &modelo.Participante{Identificador: 3, Equipo: "Sistemas"}
+	sinEquipo := &modelo.Participante{Identificador: 4}
+
+	assert.True(t, grupo.PuedeRegalar(ventas, otraDeVentas), "Sin regla cualquiera puede regalarle a cualquiera")
+
+	grupo.ReglaDeEquipos = modelo.EquiposDistintos
+	assert.False(t, grupo.PuedeRegalar(ventas, otraDeVentas), "No debería regalarle a su equipo")
+	assert.True(t, grupo.PuedeRegalar(ventas, sistemas), "Debería regalarle a otro equipo")
+	assert.True(t, grupo.PuedeRegalar(sinEquipo, ventas), "Sin equipo puede regalarle a cualquiera")
+
+	grupo.ReglaDeEquipos = modelo.MismoEquipo
+	assert.True(t, grupo.PuedeRegalar(ventas, otraDeVentas), "Debería regalarle a su equipo")
+	assert.False(t, grupo.PuedeRegalar(ventas, sistemas), "No debería regalarle a otro equipo")
+	assert.False(t, grupo.PuedeRegalar(sinEquipo, ventas), "Sin equipo sólo le regala a quienes no tienen equipo")
+}
+
+func TestUnParticipanteSabeAQuienLeRegala(t *testing.T) {
+	nick := &modelo.Participante{ID: 1, Nombre: "Nick"}
+	nay := &modelo.Participante{ID: 2, Nombre: "Nay"}
+	juli := &modelo.Participante{ID: 3, Nombre: "Juli"}
+	nick.Amigxs = []*modelo.Participante{nay, juli}
+
+	assert.True(t, nick.LeRegalaA(nay), "Debería regalarle a Nay")
+	assert.True(t, nick.LeRegalaA(juli), "Debería regalarle a Juli")
+	assert.False(t, nay.LeRegalaA(nick), "Nay no le regala a nadie")
+}
+
+func TestPorDefectoSeHaceUnRegaloPorPersona(t *testing.T) {
+	grupo := modelo.NewGrupo(123, "Mi grupo")
+
+	assert.Equal(t, 1, grupo.Regalos(), "Debería hacerse un regalo por persona")
+	grupo.RegalosPorPersona = 3
+	assert.Equal(t, 3, grupo.Regalos(), "Debería hacerse la cantidad de regalos definida")
+}
+
+func TestSePuedenAgregarVariasPersonasSinTelegram(t *testing.T) {
+	g := modelo.NewGrupo(123, "Mi grupo")
+
+	g.Agregar(modelo.NewParticipanteSinTelegram("Abuela Rosa", 1))
+	g.Agregar(modelo.NewParticipanteSinTelegram("Abuelo Tito", 1))
+	g.Agregar(modelo.NewParticipanteSinTelegram("abuela rosa", 1))
+
+	assert.Len(t, g.Participantes, 2, "Deberían agregarse sólo las personas distintas")
+}
+
+func TestLosMensajesDeQuienNoTieneTelegramLeLleganASuResponsable(t *testing.T) {
+	conTelegram := modelo.NewParticipante(123, "Nick")
+	sinTelegram := modelo.NewParticipanteSinTelegram("Abuela Rosa", 123)
+
+	assert.True(t, conTelegram.TieneTelegram(), "Nick tiene Telegram")
+	assert.False(t, sinTelegram.TieneTelegram(), "La abuela no tiene Telegram")
+	assert.Equal(t, 123, sinTelegram.Destinatario(), "Los mensajes de la abuela le llegan a Nick")
+}
+
+func TestQuienesCompartenCuentaSonHermanxs(t *testing.T) {
+	nick := modelo.NewParticipante(123, "Nick")
+	juani := modelo.NewParticipanteSinTelegram("Juani", 123)
+	sofi := modelo.NewParticipanteSinTelegram("Sofi", 123)
+	nay := modelo.NewParticipante(456, "Nay")
+	grupo := modelo.NewGrupo(1, "Mi grupo")
+
+	assert.True(t, juani.EsHermanx(sofi), "Juani y Sofi son hermanxs")
+	assert.True(t, nick.EsHermanx(juani), "Nick y Juani comparten cuenta")
+	assert.False(t, nick.EsHermanx(nay), "Nick y Nay no comparten cuenta")
+	assert.False(t, grupo.PuedeRegalar(juani, sofi), "Por defecto no se regalan entre hermanxs")
+
+	grupo.HermanxsSeRegalan = true
+	assert.True(t, grupo.PuedeRegalar(juani, sofi), "Si se permite se regalan entre hermanxs")
+}
+
+func TestDosFamiliasPuedenTenerChicxsConElMismoNombre(t *testing.T) {
+	g := modelo.NewGrupo(123, "Mi grupo")
+
+	g.Agregar(modelo.NewParticipanteSinTelegram("Juani", 1))
+	g.Agregar(modelo.NewParticipanteSinTelegram("Juani", 2))
+
+	assert.Len(t, g.Participantes, 2, "Deberían agregarse las dos personas")
+}
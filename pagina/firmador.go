@@ -0,0 +1,81 @@
+package pagina
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Ruta = "/amigxs"
+
+// Firma enlaces a la página de amigxs de una cuenta de Telegram. El enlace
+// lleva la cuenta y cuándo vence, así no hace falta guardar nada para
+// verificarlo, y sólo sirve hasta que vence
+type Firmador struct {
+	clave    []byte
+	vigencia time.Duration
+	base     string
+}
+
+// La base es la URL pública del bot, del enlace sólo se usan el esquema y el host
+func NewFirmador(clave string, vigencia time.Duration, base string) (*Firmador, error) {
+	direccion, err := url.Parse(base)
+	if err != nil || direccion.Host == "" {
+		return nil, errors.New("urlInvalida")
+	}
+	return &Firmador{clave: []byte(clave), vigencia: vigencia, base: direccion.Scheme + "://" + direccion.Host}, nil
+}
+
+func (f *Firmador) Vigencia() time.Duration {
+	return f.vigencia
+}
+
+func (f *Firmador) Enlace(cuenta int, ahora time.Time) string {
+	return f.base + Ruta + "?t=" + f.Firmar(cuenta, ahora)
+}
+
+func (f *Firmador) Firmar(cuenta int, ahora time.Time) string {
+	datos := strconv.Itoa(cuenta) + "." + strconv.FormatInt(ahora.Add(f.vigencia).Unix(), 10)
+	return datos + "." + f.firma(datos)
+}
+
+// Devuelve la cuenta para la que se firmó el token y cuándo vence
+func (f *Firmador) Verificar(token string, ahora time.Time) (int, time.Time, error) {
+	ultimoPunto := strings.LastIndex(token, ".")
+	if ultimoPunto < 0 {
+		return 0, time.Time{}, errors.New("enlaceInvalido")
+	}
+	datos := token[:ultimoPunto]
+	if !hmac.Equal([]byte(token[ultimoPunto+1:]), []byte(f.firma(datos))) {
+		return 0, time.Time{}, errors.New("enlaceInvalido")
+	}
+
+	partes := strings.Split(datos, ".")
+	if len(partes) != 2 {
+		return 0, time.Time{}, errors.New("enlaceInvalido")
+	}
+	cuenta, err := strconv.Atoi(partes[0])
+	if err != nil || cuenta <= 0 {
+		return 0, time.Time{}, errors.New("enlaceInvalido")
+	}
+	segundos, err := strconv.ParseInt(partes[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, errors.New("enlaceInvalido")
+	}
+	vence := time.Unix(segundos, 0).UTC()
+	if !ahora.Before(vence) {
+		return 0, time.Time{}, errors.New("enlaceVencido")
+	}
+	return cuenta, vence, nil
+}
+
+func (f *Firmador) firma(datos string) string {
+	mac := hmac.New(sha256.New, f.clave)
+	mac.Write([]byte("amigxs:" + datos))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
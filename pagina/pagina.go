@@ -0,0 +1,70 @@
+package pagina
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/lamaga"
+)
+
+//go:embed amigxs.html
+var textoDeLaPlantilla string
+
+var plantilla = template.Must(template.New("amigxs").Parse(textoDeLaPlantilla))
+
+// Página para ver los amigxs sin buscar el mensaje en Telegram. Muestra lo
+// mismo que /misamigxs a quien tenga un enlace firmado que no venció
+type Pagina struct {
+	maga     *lamaga.LaMaga
+	firmador *Firmador
+	registro *bitacora.Bitacora
+}
+
+type datosDeLaPagina struct {
+	Amigxs []lamaga.GrupoAmigx
+	Vence  time.Time
+	Aviso  string
+}
+
+func NewPagina(maga *lamaga.LaMaga, firmador *Firmador, registro *bitacora.Bitacora) *Pagina {
+	return &Pagina{maga: maga, firmador: firmador, registro: registro}
+}
+
+func (p *Pagina) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "metodoNoPermitido", http.StatusMethodNotAllowed)
+		return
+	}
+	// El token va en la URL, así que no tiene que quedar en cachés ni mandarse a otros sitios
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	cuenta, vence, err := p.firmador.Verificar(r.URL.Query().Get("t"), time.Now())
+	if err != nil {
+		aviso := "Este enlace no es válido, pedí uno nuevo mandándome /misamigxs"
+		if err.Error() == "enlaceVencido" {
+			aviso = "Este enlace ya venció, pedí uno nuevo mandándome /misamigxs"
+		}
+		mostrar(w, http.StatusForbidden, datosDeLaPagina{Aviso: aviso})
+		return
+	}
+
+	amigxs, err := p.maga.AmigxsDe(cuenta)
+	if err != nil {
+		p.registro.Con("usuario", cuenta).Error("Error al buscar amigxs para la página", err)
+		mostrar(w, http.StatusInternalServerError, datosDeLaPagina{Aviso: "Ups, no pude encontrar tus amigxs, probá más tarde"})
+		return
+	}
+	mostrar(w, http.StatusOK, datosDeLaPagina{Amigxs: amigxs, Vence: vence})
+}
+
+func mostrar(w http.ResponseWriter, estado int, datos datosDeLaPagina) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(estado)
+	plantilla.Execute(w, datos)
+}
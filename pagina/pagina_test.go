@@ -0,0 +1,120 @@
+package pagina_test
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/pagina"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const clave = "una-clave-para-firmar-los-enlaces-de-prueba"
+
+const IDNick = 1
+
+func firmador(t *testing.T) *pagina.Firmador {
+	firmador, err := pagina.NewFirmador(clave, 24*time.Hour, "https://www.example.com/webhook")
+	assert.NoError(t, err, "No debería fallar al crear el firmador")
+	return firmador
+}
+
+func TestElEnlaceSirveParaLaCuentaHastaQueVence(t *testing.T) {
+	ahora := time.Now()
+	f := firmador(t)
+
+	enlace := f.Enlace(IDNick, ahora)
+	assert.Regexp(t, `^https://www\.example\.com/amigxs\?t=1\.[0-9]+\.[A-Za-z0-9_-]+$`, enlace, "Debería apuntar a la página sin el camino del webhook")
+
+	cuenta, vence, err := f.Verificar(f.Firmar(IDNick, ahora), ahora.Add(time.Hour))
+	assert.NoError(t, err, "Debería aceptar el token")
+	assert.Equal(t, IDNick, cuenta, "Debería ser de la cuenta firmada")
+	assert.Equal(t, ahora.Add(24*time.Hour).Unix(), vence.Unix(), "Debería vencer en un día")
+
+	_, _, err = f.Verificar(f.Firmar(IDNick, ahora), ahora.Add(25*time.Hour))
+	assert.EqualError(t, err, "enlaceVencido", "No debería aceptar un token vencido")
+}
+
+func TestNoSePuedeCambiarElEnlace(t *testing.T) {
+	ahora := time.Now()
+	f := firmador(t)
+	token := f.Firmar(IDNick, ahora)
+
+	vence := ahora.Add(24 * time.Hour).Unix()
+	firma := token[len(fmt.Sprintf("%d.%d.", IDNick, vence)):]
+	_, _, err := f.Verificar(fmt.Sprintf("%d.%d.%s", 2, vence, firma), ahora)
+	assert.EqualError(t, err, "enlaceInvalido", "No debería servir para otra cuenta")
+	_, _, err = f.Verificar(fmt.Sprintf("%d.%d.%s", IDNick, vence+3600, firma), ahora)
+	assert.EqualError(t, err, "enlaceInvalido", "No debería poder estirarse")
+	_, _, err = f.Verificar("", ahora)
+	assert.EqualError(t, err, "enlaceInvalido", "No debería aceptar un token vacío")
+
+	otro, _ := pagina.NewFirmador("otra-clave-para-firmar-los-enlaces-de-prueba", 24*time.Hour, "https://www.example.com")
+	_, _, err = otro.Verificar(token, ahora)
+	assert.EqualError(t, err, "enlaceInvalido", "No debería servir con otra clave")
+}
+
+func magaConAmigxs(t *testing.T) *lamaga.LaMaga {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:pagina%d?mode=memory&cache=shared", rand.Int())), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.NoError(t, err, "Debería conectarse a la base de datos")
+	assert.NoError(t, lamaga.PrepararBaseDeDatos(db), "Debería ejecutar las migraciones")
+
+	maga := lamaga.NewMaga(db)
+	grupo := int64(rand.Int())
+	assert.NoError(t, maga.NuevoGrupo(grupo, "", "Los <b>primos</b>", IDNick))
+	assert.NoError(t, maga.NuevoParticipante(grupo, "", IDNick, "Nick"))
+	assert.NoError(t, maga.NuevoParticipante(grupo, "", 2, "Nay"))
+	assert.NoError(t, maga.DefinirFecha(grupo, "", IDNick, time.Date(2026, time.December, 24, 0, 0, 0, 0, time.UTC)))
+	assert.NoError(t, maga.DefinirPresupuesto(grupo, "", IDNick, "hasta $5000"))
+	assert.NoError(t, maga.DefinirDeseos(grupo, "", 2, "un libro & unas medias"))
+	_, err = maga.Sortear(grupo, "", IDNick)
+	assert.NoError(t, err, "Debería sortear")
+	return maga
+}
+
+func pedir(p *pagina.Pagina, metodo string, token string) *httptest.ResponseRecorder {
+	respuesta := httptest.NewRecorder()
+	p.ServeHTTP(respuesta, httptest.NewRequest(metodo, pagina.Ruta+"?t="+token, nil))
+	return respuesta
+}
+
+func TestLaPaginaMuestraLosAmigxsDeLaCuentaDelEnlace(t *testing.T) {
+	f := firmador(t)
+	p := pagina.NewPagina(magaConAmigxs(t), f, bitacora.Descartar())
+
+	respuesta := pedir(p, http.MethodGet, f.Firmar(IDNick, time.Now()))
+
+	assert.Equal(t, http.StatusOK, respuesta.Code)
+	assert.Equal(t, "no-store", respuesta.Header().Get("Cache-Control"), "No debería quedar en cachés")
+	assert.Equal(t, "no-referrer", respuesta.Header().Get("Referrer-Policy"), "No debería mandar el token a otros sitios")
+	assert.Contains(t, respuesta.Body.String(), "le tenés que regalar a <strong>Nay</strong>")
+	assert.Contains(t, respuesta.Body.String(), "Los &lt;b&gt;primos&lt;/b&gt;", "Debería escapar los nombres")
+	assert.Contains(t, respuesta.Body.String(), "El intercambio es el 24/12/2026")
+	assert.Contains(t, respuesta.Body.String(), "Le gustaría: un libro &amp; unas medias", "Debería mostrar los deseos de su amigx")
+	assert.Contains(t, respuesta.Body.String(), "El presupuesto es hasta $5000")
+}
+
+func TestLaPaginaNoMuestraNadaSinUnEnlaceValido(t *testing.T) {
+	f := firmador(t)
+	p := pagina.NewPagina(magaConAmigxs(t), f, bitacora.Descartar())
+
+	respuesta := pedir(p, http.MethodGet, "1.99999999999.firma")
+	assert.Equal(t, http.StatusForbidden, respuesta.Code)
+	assert.Contains(t, respuesta.Body.String(), "no es válido")
+	assert.NotContains(t, respuesta.Body.String(), "Nay")
+
+	respuesta = pedir(p, http.MethodGet, f.Firmar(IDNick, time.Now().Add(-48*time.Hour)))
+	assert.Equal(t, http.StatusForbidden, respuesta.Code)
+	assert.Contains(t, respuesta.Body.String(), "ya venció")
+
+	respuesta = pedir(p, http.MethodPost, f.Firmar(IDNick, time.Now()))
+	assert.Equal(t, http.StatusMethodNotAllowed, respuesta.Code)
+}
@@ -0,0 +1,95 @@
+package servidor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+)
+
+const EsperaDeLaBaseDeDatos = 2 * time.Second
+
+// Atiende en una sola dirección el webhook de Telegram y las rutas para
+// saber si La Maga está viva (/healthz) y lista para recibir pedidos (/readyz)
+type Servidor struct {
+	http          *http.Server
+	rutas         *http.ServeMux
+	verificarBase func(context.Context) error
+	registro      *bitacora.Bitacora
+	cerrando      int32
+}
+
+func NewServidor(direccion string, verificarBase func(context.Context) error, registro *bitacora.Bitacora) *Servidor {
+	servidor := &Servidor{rutas: http.NewServeMux(), verificarBase: verificarBase, registro: registro}
+	servidor.http = &http.Server{Addr: direccion, Handler: servidor.rutas}
+	servidor.rutas.HandleFunc("/healthz", servidor.estaVivo)
+	servidor.rutas.HandleFunc("/readyz", servidor.estaListo)
+	return servidor
+}
+
+// Mientras se cierra las rutas contestan 503 así quien las llama, como
+// Telegram con el webhook, vuelve a intentar más tarde
+func (s *Servidor) Manejar(ruta string, manejador http.Handler) {
+	s.rutas.HandleFunc(ruta, func(w http.ResponseWriter, r *http.Request) {
+		if s.estaCerrando() {
+			http.Error(w, "cerrando", http.StatusServiceUnavailable)
+			return
+		}
+		manejador.ServeHTTP(w, r)
+	})
+}
+
+func (s *Servidor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.rutas.ServeHTTP(w, r)
+}
+
+func (s *Servidor) Iniciar() error {
+	err := s.http.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Deja de aceptar pedidos nuevos pero sigue contestando /healthz y /readyz
+func (s *Servidor) Cerrando() {
+	atomic.StoreInt32(&s.cerrando, 1)
+}
+
+func (s *Servidor) Cerrar(ctx context.Context) error {
+	s.Cerrando()
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Servidor) estaCerrando() bool {
+	return atomic.LoadInt32(&s.cerrando) == 1
+}
+
+func (s *Servidor) estaVivo(w http.ResponseWriter, r *http.Request) {
+	s.contestarConLaBase(w, r)
+}
+
+func (s *Servidor) estaListo(w http.ResponseWriter, r *http.Request) {
+	if s.estaCerrando() {
+		http.Error(w, "cerrando", http.StatusServiceUnavailable)
+		return
+	}
+	s.contestarConLaBase(w, r)
+}
+
+func (s *Servidor) contestarConLaBase(w http.ResponseWriter, r *http.Request) {
+	ctx, cancelar := context.WithTimeout(r.Context(), EsperaDeLaBaseDeDatos)
+	defer cancelar()
+
+	err := s.verificarBase(ctx)
+	if err != nil {
+		s.registro.Con("ruta", r.URL.Path).Error("La base de datos no responde", err)
+		http.Error(w, "baseDeDatos", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
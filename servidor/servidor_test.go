@@ -0,0 +1,55 @@
+package servidor_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/servidor"
+	"github.com/stretchr/testify/assert"
+)
+
+func baseQueResponde(ctx context.Context) error {
+	return nil
+}
+
+func baseQueNoResponde(ctx context.Context) error {
+	return errors.New("sinConexion")
+}
+
+func pedir(s *servidor.Servidor, ruta string) *httptest.ResponseRecorder {
+	respuesta := httptest.NewRecorder()
+	s.ServeHTTP(respuesta, httptest.NewRequest(http.MethodGet, ruta, nil))
+	return respuesta
+}
+
+func TestElServidorEstaVivoYListoSiLaBaseResponde(t *testing.T) {
+	s := servidor.NewServidor(":0", baseQueResponde, bitacora.Descartar())
+
+	assert.Equal(t, http.StatusOK, pedir(s, "/healthz").Code, "Debería estar vivo")
+	assert.Equal(t, http.StatusOK, pedir(s, "/readyz").Code, "Debería estar listo")
+}
+
+func TestElServidorNoEstaListoSiLaBaseNoResponde(t *testing.T) {
+	s := servidor.NewServidor(":0", baseQueNoResponde, bitacora.Descartar())
+
+	assert.Equal(t, http.StatusServiceUnavailable, pedir(s, "/healthz").Code, "No debería estar vivo")
+	assert.Equal(t, http.StatusServiceUnavailable, pedir(s, "/readyz").Code, "No debería estar listo")
+}
+
+func TestElServidorDejaDeAceptarPedidosAlCerrar(t *testing.T) {
+	s := servidor.NewServidor(":0", baseQueResponde, bitacora.Descartar())
+	s.Manejar("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	assert.Equal(t, http.StatusOK, pedir(s, "/").Code, "Debería atender el webhook")
+
+	s.Cerrando()
+
+	assert.Equal(t, http.StatusServiceUnavailable, pedir(s, "/").Code, "No debería aceptar actualizaciones")
+	assert.Equal(t, http.StatusServiceUnavailable, pedir(s, "/readyz").Code, "No debería estar listo")
+	assert.Equal(t, http.StatusOK, pedir(s, "/healthz").Code, "Debería seguir vivo")
+}
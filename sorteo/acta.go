@@ -0,0 +1,140 @@
+package sorteo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mathrand "math/rand"
+
+	"github.com/nickrisaro/invisible-bot/modelo"
+)
+
+// El acta tiene todo lo necesario para repetir un sorteo: la semilla, las
+// reglas, quiénes participaron y a quién le tocó cada une. Al sortear se
+// publica su hash como compromiso y al revelar se publica el acta completa,
+// así cualquiera puede comprobar que no se cambió y que sale de la semilla
+type Acta struct {
+	Semilla           string                `json:"semilla"`
+	Regalos           int                   `json:"regalos"`
+	ReglaDeEquipos    string                `json:"reglaDeEquipos"`
+	HermanxsSeRegalan bool                  `json:"hermanxsSeRegalan"`
+	Participantes     []ParticipanteDelActa `json:"participantes"`
+	Asignaciones      [][]int               `json:"asignaciones"`
+}
+
+// En lugar de los identificadores de Telegram el acta numera las cuentas
+type ParticipanteDelActa struct {
+	Nombre   string `json:"nombre"`
+	Equipo   string `json:"equipo"`
+	Cuenta   int    `json:"cuenta"`
+	Telegram bool   `json:"telegram"`
+}
+
+func NuevaActa(grupo *modelo.Grupo) (*Acta, error) {
+	aleatorio := make([]byte, 16)
+	_, err := rand.Read(aleatorio)
+	if err != nil {
+		return nil, err
+	}
+
+	acta := Acta{
+		Semilla:           hex.EncodeToString(aleatorio),
+		Regalos:           grupo.Regalos(),
+		ReglaDeEquipos:    grupo.ReglaDeEquipos,
+		HermanxsSeRegalan: grupo.HermanxsSeRegalan,
+		Participantes:     make([]ParticipanteDelActa, 0, len(grupo.Participantes)),
+	}
+
+	cuentas := make(map[int]int)
+	for _, participante := range grupo.Participantes {
+		cuenta, existe := cuentas[participante.Destinatario()]
+		if !existe {
+			cuenta = len(cuentas) + 1
+			cuentas[participante.Destinatario()] = cuenta
+		}
+		acta.Participantes = append(acta.Participantes, ParticipanteDelActa{
+			Nombre:   participante.Nombre,
+			Equipo:   participante.Equipo,
+			Cuenta:   cuenta,
+			Telegram: participante.TieneTelegram(),
+		})
+	}
+
+	return &acta, nil
+}
+
+func LeerActa(contenido []byte) (*Acta, error) {
+	acta := Acta{}
+	err := json.Unmarshal(contenido, &acta)
+	if err != nil {
+		return nil, err
+	}
+	return &acta, nil
+}
+
+func (a *Acta) Sortear() bool {
+	grupo := a.grupo()
+	asignaciones, sePudo := Sortear(a.generador(), len(grupo.Participantes), a.Regalos, func(de int, para int) bool {
+		return grupo.PuedeRegalar(grupo.Participantes[de], grupo.Participantes[para])
+	})
+	a.Asignaciones = asignaciones
+	return sePudo
+}
+
+func (a *Acta) Texto() ([]byte, error) {
+	return json.MarshalIndent(a, "", "  ")
+}
+
+func Compromiso(texto []byte) string {
+	hash := sha256.Sum256(texto)
+	return hex.EncodeToString(hash[:])
+}
+
+// Repite el sorteo con la semilla del acta y se fija que dé lo mismo
+func (a *Acta) Verificar() error {
+	repetida := *a
+	if !repetida.Sortear() {
+		return errors.New("sorteoImposible")
+	}
+
+	if len(repetida.Asignaciones) != len(a.Asignaciones) {
+		return errors.New("asignacionDistinta")
+	}
+	for de, asignadas := range repetida.Asignaciones {
+		if len(asignadas) != len(a.Asignaciones[de]) {
+			return errors.New("asignacionDistinta")
+		}
+		for i, para := range asignadas {
+			if para != a.Asignaciones[de][i] {
+				return errors.New("asignacionDistinta")
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Acta) generador() *mathrand.Rand {
+	hash := sha256.Sum256([]byte(a.Semilla))
+	return mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(hash[:8]))))
+}
+
+func (a *Acta) grupo() *modelo.Grupo {
+	grupo := modelo.Grupo{
+		RegalosPorPersona: a.Regalos,
+		ReglaDeEquipos:    a.ReglaDeEquipos,
+		HermanxsSeRegalan: a.HermanxsSeRegalan,
+	}
+	for _, participanteDelActa := range a.Participantes {
+		participante := modelo.Participante{Nombre: participanteDelActa.Nombre, Equipo: participanteDelActa.Equipo}
+		if participanteDelActa.Telegram {
+			participante.Identificador = participanteDelActa.Cuenta
+		} else {
+			participante.Responsable = participanteDelActa.Cuenta
+		}
+		grupo.Participantes = append(grupo.Participantes, &participante)
+	}
+	return &grupo
+}
@@ -0,0 +1,76 @@
+package sorteo_test
+
+import (
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/sorteo"
+	"github.com/stretchr/testify/assert"
+)
+
+func grupoDePrueba() *modelo.Grupo {
+	grupo := modelo.NewGrupo(123, "Mi grupo")
+	grupo.Agregar(modelo.NewParticipante(1, "Nick"))
+	grupo.Agregar(modelo.NewParticipante(2, "Nay"))
+	grupo.Agregar(modelo.NewParticipante(3, "Juli"))
+	grupo.Agregar(modelo.NewParticipanteSinTelegram("Juani", 3))
+	grupo.Agregar(modelo.NewParticipante(4, "Lu"))
+	return grupo
+}
+
+func TestElActaNoTieneLosIdentificadoresDeTelegram(t *testing.T) {
+	acta, err := sorteo.NuevaActa(grupoDePrueba())
+
+	assert.NoError(t, err, "No debería fallar al crear el acta")
+	assert.Len(t, acta.Semilla, 32, "Debería tener una semilla")
+	cuentas := []int{}
+	for _, participante := range acta.Participantes {
+		cuentas = append(cuentas, participante.Cuenta)
+	}
+	assert.Equal(t, []int{1, 2, 3, 3, 4}, cuentas, "Debería numerar las cuentas")
+}
+
+func TestLaMismaSemillaDaElMismoSorteo(t *testing.T) {
+	acta, _ := sorteo.NuevaActa(grupoDePrueba())
+	assert.True(t, acta.Sortear(), "Debería poder sortear")
+
+	otra := *acta
+	otra.Sortear()
+
+	assert.Equal(t, acta.Asignaciones, otra.Asignaciones, "La misma semilla debería dar el mismo sorteo")
+	assert.NoError(t, acta.Verificar(), "El sorteo debería verificarse")
+}
+
+func TestElSorteoDelActaRespetaLasReglas(t *testing.T) {
+	acta, _ := sorteo.NuevaActa(grupoDePrueba())
+	acta.Sortear()
+
+	for de, asignadas := range acta.Asignaciones {
+		assert.Len(t, asignadas, 1, "Cada persona debería hacer un regalo")
+		assert.NotEqual(t, acta.Participantes[de].Cuenta, acta.Participantes[asignadas[0]].Cuenta, "Nadie le regala a alguien de su cuenta")
+	}
+}
+
+func TestNoSeVerificaUnSorteoCambiado(t *testing.T) {
+	acta, _ := sorteo.NuevaActa(grupoDePrueba())
+	acta.Sortear()
+	acta.Asignaciones[0], acta.Asignaciones[1] = acta.Asignaciones[1], acta.Asignaciones[0]
+
+	assert.EqualError(t, acta.Verificar(), "asignacionDistinta", "No debería verificarse un sorteo cambiado")
+}
+
+func TestElCompromisoCambiaSiCambiaElActa(t *testing.T) {
+	acta, _ := sorteo.NuevaActa(grupoDePrueba())
+	acta.Sortear()
+	texto, err := acta.Texto()
+	assert.NoError(t, err, "No debería fallar al escribir el acta")
+	compromiso := sorteo.Compromiso(texto)
+
+	leida, err := sorteo.LeerActa(texto)
+	assert.NoError(t, err, "No debería fallar al leer el acta")
+	assert.Equal(t, acta, leida, "Debería leer la misma acta")
+
+	leida.Semilla = "otra"
+	otroTexto, _ := leida.Texto()
+	assert.NotEqual(t, compromiso, sorteo.Compromiso(otroTexto), "El compromiso debería cambiar")
+}
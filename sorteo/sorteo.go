@@ -0,0 +1,79 @@
+package sorteo
+
+import "math/rand"
+
+const intentosDeSorteo = 20
+
+// Sortea a quiénes les regala cada participante, cada persona hace y recibe
+// la misma cantidad de regalos y nunca dos a la misma persona. Arma una ronda
+// de emparejamientos por regalo y si alguna ronda se traba vuelve a empezar
+func Sortear(aleatorio *rand.Rand, cantidad int, regalos int, puedeRegalar func(de int, a int) bool) ([][]int, bool) {
+	for intento := 0; intento < intentosDeSorteo; intento++ {
+		asignados := make([][]int, cantidad)
+		yaLeRegala := make([]map[int]bool, cantidad)
+		for i := range yaLeRegala {
+			yaLeRegala[i] = make(map[int]bool, regalos)
+		}
+
+		completo := true
+		for ronda := 0; ronda < regalos && completo; ronda++ {
+			regalaA, sePudo := Emparejar(aleatorio, cantidad, cantidad, func(de int, a int) bool {
+				return !yaLeRegala[de][a] && puedeRegalar(de, a)
+			})
+			if !sePudo {
+				completo = false
+				break
+			}
+			for de, a := range regalaA {
+				asignados[de] = append(asignados[de], a)
+				yaLeRegala[de][a] = true
+			}
+		}
+
+		if completo {
+			return asignados, true
+		}
+	}
+
+	return nil, false
+}
+
+// Busca al azar a quién le regala cada participante respetando puedeRegalar.
+// Es un emparejamiento entre quienes regalan y quienes reciben, así que si
+// existe alguna forma de que regalen todxs la encuentra. Quienes se quedan sin
+// a quién regalarle tienen -1
+func Emparejar(aleatorio *rand.Rand, quienesRegalan int, quienesReciben int, puedeRegalar func(de int, a int) bool) ([]int, bool) {
+	regalaA := make([]int, quienesRegalan)
+	for i := range regalaA {
+		regalaA[i] = -1
+	}
+	recibeDe := make([]int, quienesReciben)
+	for i := range recibeDe {
+		recibeDe[i] = -1
+	}
+
+	var buscar func(de int, visitados []bool) bool
+	buscar = func(de int, visitados []bool) bool {
+		for _, a := range aleatorio.Perm(quienesReciben) {
+			if visitados[a] || !puedeRegalar(de, a) {
+				continue
+			}
+			visitados[a] = true
+			if recibeDe[a] == -1 || buscar(recibeDe[a], visitados) {
+				regalaA[de] = a
+				recibeDe[a] = de
+				return true
+			}
+		}
+		return false
+	}
+
+	completo := true
+	for _, de := range aleatorio.Perm(quienesRegalan) {
+		if !buscar(de, make([]bool, quienesReciben)) {
+			completo = false
+		}
+	}
+
+	return regalaA, completo
+}
@@ -0,0 +1,42 @@
+package sorteo_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/nickrisaro/invisible-bot/sorteo"
+	"github.com/stretchr/testify/assert"
+)
+
+// Con tres personas, si las dos primeras se regalan entre sí sólo le queda a
+// la última regalarse a sí misma. El sorteo viejo se quedaba buscando para
+// siempre, éste tiene que reacomodar los regalos
+func TestElSorteoNoSeTrabaCuandoSoloQuedaLaUltimaPersona(t *testing.T) {
+	for semilla := int64(0); semilla < 200; semilla++ {
+		asignados, sePudo := sorteo.Sortear(rand.New(rand.NewSource(semilla)), 3, 1, func(de int, a int) bool {
+			return de != a
+		})
+
+		assert.True(t, sePudo, "Debería poder sortear con la semilla %d", semilla)
+		recibieron := make(map[int]bool)
+		for de, amigxs := range asignados {
+			assert.Len(t, amigxs, 1, "Cada persona debería hacer un regalo")
+			assert.NotEqual(t, de, amigxs[0], "Nadie debería regalarse a sí misme")
+			recibieron[amigxs[0]] = true
+		}
+		assert.Len(t, recibieron, 3, "Cada persona debería recibir un regalo")
+	}
+}
+
+func TestElEmparejamientoReacomodaALaUltimaPersona(t *testing.T) {
+	// 0 y 1 sólo se pueden regalar entre sí o a 2, y 2 sólo le puede regalar a 0
+	puedeRegalar := func(de int, a int) bool {
+		return de != a && (de != 2 || a == 0)
+	}
+	for semilla := int64(0); semilla < 50; semilla++ {
+		regalaA, sePudo := sorteo.Emparejar(rand.New(rand.NewSource(semilla)), 3, 3, puedeRegalar)
+
+		assert.True(t, sePudo, "Debería encontrar el emparejamiento con la semilla %d", semilla)
+		assert.Equal(t, []int{1, 2, 0}, regalaA, "Sólo hay una forma de que regalen todxs")
+	}
+}
@@ -0,0 +1,193 @@
+package telegram
+
+import (
+	"strconv"
+
+	"github.com/nickrisaro/invisible-bot/config"
+	"github.com/nickrisaro/invisible-bot/lamaga"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const ayudaDeAdministracion = "Comandos para administrar La Maga:\n" +
+	" * /admin grupos lista todos los juegos\n" +
+	" * /admin grupo <id> muestra un juego, con /admin grupo <id> forzar también a quién le regala cada une\n" +
+	" * /admin reenviar <id> le vuelve a mandar su amigx a cada participante del juego\n" +
+	" * /admin broadcast <texto> le manda el texto a todas las personas que están jugando\n"
+
+// Los comandos de administración sólo se atienden por privado y para las
+// cuentas que están en la configuración
+func manejarAdministracion(b *tb.Bot, cola *Cola, pedidos *pedidosEnCurso, confirmaciones *Confirmaciones, maga *lamaga.LaMaga, configuracion *config.Config) {
+	manejarComando(b, pedidos, "/admin", func(m *tb.Message) {
+		if !m.Private() || !configuracion.EsAdministrador(m.Sender.ID) {
+			pedidos.registroDe(m).Advertir("Pidieron administrar sin permiso", nil)
+			cola.Send(m.Chat, "Ese comando es sólo para quien administra La Maga")
+			return
+		}
+
+		subcomando, argumentos := primeraPalabra(m.Payload)
+		switch subcomando {
+		case "grupos":
+			listarJuegos(cola, pedidos, maga, m)
+		case "grupo":
+			mostrarJuego(cola, pedidos, maga, m, argumentos)
+		case "reenviar":
+			reenviarJuego(cola, pedidos, maga, m, argumentos)
+		case "broadcast":
+			if len(argumentos) == 0 {
+				cola.Send(m.Chat, "Decime qué querés mandar, por ejemplo /admin broadcast Hola a todxs")
+				return
+			}
+			pedirConfirmacion(cola, pedidos, confirmaciones, m, "¿Le mando este mensaje a todas las personas que están jugando?\n\n"+argumentos, func() {
+				difundir(cola, pedidos, maga, m, argumentos)
+			})
+		default:
+			cola.Send(m.Chat, ayudaDeAdministracion)
+		}
+	})
+}
+
+func listarJuegos(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message) {
+	resumenes, err := maga.ResumenDeJuegos()
+	if err != nil {
+		pedidos.fallo(m, err, "Error al listar juegos para administrar")
+		cola.Send(m.Chat, "Ups, no pude buscar los juegos, probá más tarde")
+		return
+	}
+	if len(resumenes) == 0 {
+		cola.Send(m.Chat, "Todavía no hay ningún juego")
+		return
+	}
+
+	lista := "Estos son todos los juegos:\n"
+	for _, resumen := range resumenes {
+		lista += " * " + strconv.FormatUint(uint64(resumen.Grupo.ID), 10) + ": " + resumen.Grupo.Titulo() + ", " + estadoDelJuego(resumen) + "\n"
+	}
+	mandarEnPartes(cola, m.Chat, lista)
+}
+
+func mostrarJuego(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message, argumentos string) {
+	textoDelID, opcion := primeraPalabra(argumentos)
+	id, err := strconv.ParseUint(textoDelID, 10, 0)
+	if err != nil {
+		cola.Send(m.Chat, "Decime qué juego querés ver, por ejemplo /admin grupo 12")
+		return
+	}
+
+	resumen, err := maga.ResumenDelJuego(uint(id))
+	if err != nil {
+		pedidos.fallo(m, err, "Error al buscar juego para administrar")
+		avisarErrorDeAdministracion(cola, m, err)
+		return
+	}
+
+	grupo := resumen.Grupo
+	detalle := grupo.Titulo() + " (chat " + strconv.FormatInt(grupo.Identificador, 10) + ")\n"
+	detalle += "Organiza " + strconv.Itoa(grupo.Organizador) + ", " + estadoDelJuego(*resumen) + "\n"
+	if grupo.Fecha != nil {
+		detalle += "El intercambio es el " + grupo.Fecha.Format(FormatoDeFecha) + "\n"
+	}
+	detalle += "Participantes:\n"
+	for _, participante := range grupo.Participantes {
+		detalle += " * " + participante.Nombre + " (" + strconv.Itoa(participante.Destinatario()) + ")"
+		if participante.SeFue {
+			detalle += ", se fue"
+		} else if grupo.YaSorteo {
+			detalle += ", notificación " + participante.Notificacion.Estado
+		}
+		detalle += "\n"
+	}
+	mandarEnPartes(cola, m.Chat, detalle)
+
+	if opcion != "forzar" {
+		return
+	}
+	participantes, err := maga.ConBitacora(pedidos.registroDe(m)).AmigxsDelJuego(uint(id), m.Sender.ID)
+	if err != nil {
+		pedidos.fallo(m, err, "Error al buscar regalos para administrar")
+		avisarErrorDeAdministracion(cola, m, err)
+		return
+	}
+	regalos := "Quién le regala a quién:\n"
+	for _, participante := range participantes {
+		if participante.SeFue {
+			continue
+		}
+		regalos += " * " + participante.Nombre + " le regala a " + nombresDeAmigxs(participante) + "\n"
+	}
+	mandarEnPartes(cola, m.Chat, regalos)
+}
+
+func reenviarJuego(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message, argumentos string) {
+	id, err := strconv.ParseUint(argumentos, 10, 0)
+	if err != nil {
+		cola.Send(m.Chat, "Decime a qué juego le reenvío los amigxs, por ejemplo /admin reenviar 12")
+		return
+	}
+
+	notificaciones, err := maga.NotificacionesDelJuego(uint(id), m.Sender.ID)
+	if err != nil {
+		pedidos.fallo(m, err, "Error al buscar notificaciones para reenviar")
+		avisarErrorDeAdministracion(cola, m, err)
+		return
+	}
+
+	cola.Trabajo(func() {
+		entregadas := 0
+		for _, notificacion := range notificaciones {
+			if notificar(cola, maga, notificacion.Participante, notificacion.Grupo) {
+				entregadas++
+			}
+		}
+		cola.Send(m.Chat, "Listo, reenvié "+strconv.Itoa(entregadas)+" de "+strconv.Itoa(len(notificaciones))+" mensajes")
+	})
+}
+
+func difundir(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message, texto string) {
+	cuentas, err := maga.CuentasQueJuegan()
+	if err != nil {
+		pedidos.fallo(m, err, "Error al buscar a quiénes mandar el mensaje")
+		cola.Send(m.Chat, "Ups, no pude buscar a quiénes mandarles el mensaje, probá más tarde")
+		return
+	}
+
+	pedidos.registroDe(m).Con("cuentas", len(cuentas)).Informar("Mandando mensaje a todas las personas que juegan")
+	cola.Trabajo(func() {
+		entregados := 0
+		for _, cuenta := range cuentas {
+			_, err := cola.Send(&tb.User{ID: cuenta}, texto)
+			if err != nil {
+				pedidos.registroDe(m).Con("destinatario", cuenta).Advertir("Error al mandar mensaje a todas las personas", err)
+				continue
+			}
+			entregados++
+		}
+		cola.Send(m.Chat, "Listo, le mandé el mensaje a "+strconv.Itoa(entregados)+" de "+strconv.Itoa(len(cuentas))+" personas")
+	})
+}
+
+func estadoDelJuego(resumen lamaga.ResumenDeJuego) string {
+	estado := strconv.Itoa(resumen.Participantes) + " participantes"
+	if resumen.Grupo.ArchivadoEn.Valid {
+		return estado + ", terminado"
+	}
+	if resumen.Grupo.Revelado {
+		return estado + ", revelado"
+	}
+	if resumen.Grupo.YaSorteo {
+		return estado + ", sorteado, " + strconv.Itoa(resumen.SinNotificar) + " sin notificar"
+	}
+	return estado + ", sin sortear"
+}
+
+func avisarErrorDeAdministracion(cola *Cola, m *tb.Message, err error) {
+	switch err.Error() {
+	case "noExisteElJuego":
+		cola.Send(m.Chat, "No existe ese juego, fijate los números con /admin grupos")
+	case "noSorteado":
+		cola.Send(m.Chat, "Ese juego todavía no sorteó")
+	case "juegoTerminado":
+		cola.Send(m.Chat, "Ese juego ya terminó")
+	default:
+		cola.Send(m.Chat, "Ups, algo falló, fijate en los logs")
+	}
+}
@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/modelo"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type Bot struct {
+	*tb.Bot
+	*Notificador
+	cola    *Cola
+	maga    *lamaga.LaMaga
+	webhook *tb.Webhook
+	pedidos *pedidosEnCurso
+	recibir func(u *tb.Update)
+	detener chan struct{}
+	parar   chan struct{}
+}
+
+// En modo polling no hay webhook que atender
+func (b *Bot) Webhook() http.Handler {
+	if b.webhook == nil {
+		return nil
+	}
+	return b.webhook
+}
+
+// Como el Start de telebot, pero cada actualización se cuenta en la cola antes
+// de salir a atenderla, así Detener espera también a las que recién llegaron.
+// Lo que se anota al recibir se hace en orden, antes de pasar a la siguiente
+func (b *Bot) Start() {
+	pararPoller := make(chan struct{})
+	go b.Poller.Poll(b.Bot, b.Updates, pararPoller)
+
+	for {
+		select {
+		case u := <-b.Updates:
+			b.cola.Trabajo(func() {
+				b.pedidos.recibir(&u)
+				b.recibir(&u)
+			})
+			b.cola.EnSegundoPlano(func() {
+				b.ProcessUpdate(u)
+				b.pedidos.atendido(&u)
+			})
+		case <-b.detener:
+			close(pararPoller)
+			return
+		}
+	}
+}
+
+// Deja de recibir actualizaciones y espera a que se terminen de atender las
+// que llegaron y de mandar los mensajes en curso. Start tiene que estar corriendo
+func (b *Bot) Detener(ctx context.Context) error {
+	b.detener <- struct{}{}
+	close(b.parar)
+	return b.cola.Vaciar(ctx)
+}
+
+// Para sortear o volver a notificar desde fuera de Telegram, por ejemplo desde
+// la API. Avisa en el grupo y a cada participante igual que con /sortear, pero
+// en segundo plano para que quien avisa no espere a que salgan todos los
+// mensajes. Al cerrar, la cola espera a que terminen
+type Notificador struct {
+	cola *Cola
+	maga *lamaga.LaMaga
+}
+
+func NewNotificador(cola *Cola, maga *lamaga.LaMaga) *Notificador {
+	return &Notificador{cola: cola, maga: maga}
+}
+
+func (n *Notificador) AnunciarSorteo(grupo *modelo.Grupo, sorteados []*modelo.Participante) {
+	chat := &tb.Chat{ID: grupo.Identificador}
+	n.cola.EnSegundoPlano(func() {
+		mandarMensajesA(n.cola, n.maga, chat, sorteados, grupo.Titulo())
+		mandarCompromiso(n.cola, chat, grupo.Compromiso)
+	})
+}
+
+func (n *Notificador) MandarAmigxs(grupo *modelo.Grupo, sorteados []*modelo.Participante) {
+	n.cola.EnSegundoPlano(func() {
+		mandarMensajesA(n.cola, n.maga, &tb.Chat{ID: grupo.Identificador}, sorteados, grupo.Titulo())
+	})
+}
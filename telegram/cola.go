@@ -0,0 +1,208 @@
+package telegram
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const maximoDeReintentosPorFlood = 3
+
+type Enviador interface {
+	Send(to tb.Recipient, what interface{}, options ...interface{}) (*tb.Message, error)
+	Edit(msg tb.Editable, what interface{}, options ...interface{}) (*tb.Message, error)
+	Respond(c *tb.Callback, resp ...*tb.CallbackResponse) error
+}
+
+type Limites struct {
+	EntreMensajes        time.Duration
+	EntreMensajesPrivado time.Duration
+	EntreMensajesGrupo   time.Duration
+}
+
+// Los límites que documenta Telegram: 30 mensajes por segundo en total,
+// uno por segundo en cada chat privado y 20 por minuto en cada grupo
+var LimitesDeTelegram = Limites{
+	EntreMensajes:        time.Second / 30,
+	EntreMensajesPrivado: time.Second,
+	EntreMensajesGrupo:   3 * time.Second,
+}
+
+func NewLimites(mensajesPorSegundo int, mensajesPorSegundoPrivado int, mensajesPorMinutoEnGrupos int) Limites {
+	return Limites{
+		EntreMensajes:        time.Second / time.Duration(mensajesPorSegundo),
+		EntreMensajesPrivado: time.Second / time.Duration(mensajesPorSegundoPrivado),
+		EntreMensajesGrupo:   time.Minute / time.Duration(mensajesPorMinutoEnGrupos),
+	}
+}
+
+type Cola struct {
+	enviador         Enviador
+	limites          Limites
+	mutex            sync.Mutex
+	proximoTurno     time.Time
+	proximoTurnoChat map[string]time.Time
+	enCurso          int
+	vacia            chan struct{}
+	registro         *bitacora.Bitacora
+	ahora            func() time.Time
+	dormir           func(time.Duration)
+}
+
+func NewCola(enviador Enviador, limites Limites) *Cola {
+	return &Cola{enviador: enviador, limites: limites, proximoTurnoChat: make(map[string]time.Time), registro: bitacora.Descartar(), ahora: time.Now, dormir: time.Sleep}
+}
+
+func (c *Cola) UsarBitacora(registro *bitacora.Bitacora) {
+	c.registro = registro
+}
+
+// Para las pruebas, así no dependen de cuánto tarda la máquina
+func (c *Cola) UsarReloj(ahora func() time.Time, dormir func(time.Duration)) {
+	c.ahora = ahora
+	c.dormir = dormir
+}
+
+func (c *Cola) Send(destino tb.Recipient, mensaje interface{}, opciones ...interface{}) (*tb.Message, error) {
+	return c.enTurno(destino.Recipient(), func() (*tb.Message, error) {
+		return c.enviador.Send(destino, mensaje, opciones...)
+	})
+}
+
+// Para Telegram editar un mensaje cuenta igual que mandar uno nuevo al chat
+func (c *Cola) Editar(editado tb.Editable, mensaje interface{}, opciones ...interface{}) (*tb.Message, error) {
+	_, chat := editado.MessageSig()
+	return c.enTurno(strconv.FormatInt(chat, 10), func() (*tb.Message, error) {
+		return c.enviador.Edit(editado, mensaje, opciones...)
+	})
+}
+
+// Las respuestas a los botones no son mensajes en el chat y Telegram las
+// espera enseguida, así que no hacen fila pero sí se esperan al cerrar
+func (c *Cola) Responder(callback *tb.Callback, respuesta *tb.CallbackResponse) error {
+	c.empezar()
+	defer c.terminar()
+	return c.enviador.Respond(callback, respuesta)
+}
+
+func (c *Cola) enTurno(chat string, enviar func() (*tb.Message, error)) (*tb.Message, error) {
+	c.empezar()
+	defer c.terminar()
+
+	for intento := 0; ; intento++ {
+		turno := c.reservarTurno(chat)
+		c.dormir(turno.Sub(c.ahora()))
+
+		enviado, err := enviar()
+		flood, esFlood := err.(tb.FloodError)
+		if !esFlood || intento == maximoDeReintentosPorFlood {
+			return enviado, err
+		}
+
+		c.registro.Con("chat", chat).Con("segundos", flood.RetryAfter).Advertir("Telegram pidió esperar", err)
+		c.esperar(chat, time.Duration(flood.RetryAfter)*time.Second)
+	}
+}
+
+// Un trabajo agrupa varios envíos, así al cerrar se espera a que termine
+// completo y no queda la mitad de las personas sin su mensaje
+func (c *Cola) Trabajo(trabajo func()) {
+	c.empezar()
+	defer c.terminar()
+	trabajo()
+}
+
+func (c *Cola) EnSegundoPlano(trabajo func()) {
+	c.empezar()
+	go func() {
+		defer c.terminar()
+		trabajo()
+	}()
+}
+
+// Espera a que terminen los envíos y trabajos en curso o a que se acabe el contexto
+func (c *Cola) Vaciar(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.enCurso == 0 {
+		c.mutex.Unlock()
+		return nil
+	}
+	if c.vacia == nil {
+		c.vacia = make(chan struct{})
+	}
+	vacia := c.vacia
+	c.mutex.Unlock()
+
+	select {
+	case <-vacia:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Cola) empezar() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.enCurso++
+}
+
+func (c *Cola) terminar() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.enCurso--
+	if c.enCurso == 0 && c.vacia != nil {
+		close(c.vacia)
+		c.vacia = nil
+	}
+}
+
+func (c *Cola) reservarTurno(chat string) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ahora := c.ahora()
+	// Los chats que ya pueden volver a recibir no necesitan turno guardado, así
+	// el mapa sólo tiene los chats que recibieron algo hace unos segundos
+	for otro, proximo := range c.proximoTurnoChat {
+		if !proximo.After(ahora) {
+			delete(c.proximoTurnoChat, otro)
+		}
+	}
+
+	turno := ahora
+	if c.proximoTurno.After(turno) {
+		turno = c.proximoTurno
+	}
+	if c.proximoTurnoChat[chat].After(turno) {
+		turno = c.proximoTurnoChat[chat]
+	}
+
+	c.proximoTurno = turno.Add(c.limites.EntreMensajes)
+	if esGrupo(chat) {
+		c.proximoTurnoChat[chat] = turno.Add(c.limites.EntreMensajesGrupo)
+	} else {
+		c.proximoTurnoChat[chat] = turno.Add(c.limites.EntreMensajesPrivado)
+	}
+
+	return turno
+}
+
+func (c *Cola) esperar(chat string, espera time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hasta := c.ahora().Add(espera)
+	if hasta.After(c.proximoTurnoChat[chat]) {
+		c.proximoTurnoChat[chat] = hasta
+	}
+}
+
+func esGrupo(chat string) bool {
+	return strings.HasPrefix(chat, "-")
+}
@@ -0,0 +1,174 @@
+package telegram_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/telegram"
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// Sólo avanza cuando la cola duerme, así las pruebas no dependen de la máquina
+type relojDePrueba struct {
+	mutex sync.Mutex
+	hora  time.Time
+}
+
+func (r *relojDePrueba) ahora() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.hora
+}
+
+func (r *relojDePrueba) dormir(espera time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if espera > 0 {
+		r.hora = r.hora.Add(espera)
+	}
+}
+
+type enviadorDePrueba struct {
+	mutex    sync.Mutex
+	reloj    *relojDePrueba
+	envios   map[string][]time.Time
+	floods   int
+	esperaEn int
+}
+
+func newEnviadorDePrueba() *enviadorDePrueba {
+	return &enviadorDePrueba{reloj: &relojDePrueba{hora: time.Date(2026, 12, 24, 21, 0, 0, 0, time.UTC)}, envios: make(map[string][]time.Time), esperaEn: 2}
+}
+
+func (e *enviadorDePrueba) nuevaCola() *telegram.Cola {
+	cola := telegram.NewCola(e, limitesDePrueba)
+	cola.UsarReloj(e.reloj.ahora, e.reloj.dormir)
+	return cola
+}
+
+func (e *enviadorDePrueba) Send(to tb.Recipient, what interface{}, options ...interface{}) (*tb.Message, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.envios[to.Recipient()] = append(e.envios[to.Recipient()], e.reloj.ahora())
+	if e.floods > 0 {
+		e.floods--
+		return nil, tb.FloodError{APIError: tb.NewAPIError(429, "Too Many Requests"), RetryAfter: e.esperaEn}
+	}
+	return &tb.Message{}, nil
+}
+
+func (e *enviadorDePrueba) Edit(msg tb.Editable, what interface{}, options ...interface{}) (*tb.Message, error) {
+	_, chat := msg.MessageSig()
+	return e.Send(&tb.Chat{ID: chat}, what, options...)
+}
+
+func (e *enviadorDePrueba) Respond(c *tb.Callback, resp ...*tb.CallbackResponse) error {
+	return nil
+}
+
+var limitesDePrueba = telegram.Limites{
+	EntreMensajes:        time.Millisecond,
+	EntreMensajesPrivado: 20 * time.Millisecond,
+	EntreMensajesGrupo:   50 * time.Millisecond,
+}
+
+func TestLaColaEspaciaLosMensajesAUnMismoChat(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	cola := enviador.nuevaCola()
+
+	for i := 0; i < 3; i++ {
+		_, err := cola.Send(&tb.Chat{ID: -1234}, "Hola")
+		assert.NoError(t, err, "No debería fallar al enviar")
+	}
+
+	envios := enviador.envios["-1234"]
+	assert.Len(t, envios, 3, "Debería haber mandado tres mensajes")
+	for i := 1; i < len(envios); i++ {
+		assert.GreaterOrEqual(t, int64(envios[i].Sub(envios[i-1])), int64(limitesDePrueba.EntreMensajesGrupo), "Debería respetar el límite del grupo")
+	}
+}
+
+func TestLaColaEspaciaLasEdicionesConLosMensajesDelChat(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	cola := enviador.nuevaCola()
+	grupo := &tb.Chat{ID: -1234}
+
+	pregunta, _ := cola.Send(grupo, "¿Sorteo?")
+	pregunta.Chat = grupo
+	_, err := cola.Editar(pregunta, "¿Sorteo?\nSí")
+
+	assert.NoError(t, err, "No debería fallar al editar")
+	envios := enviador.envios["-1234"]
+	assert.Len(t, envios, 2, "La edición debería ir al mismo chat")
+	assert.GreaterOrEqual(t, int64(envios[1].Sub(envios[0])), int64(limitesDePrueba.EntreMensajesGrupo), "La edición debería esperar su turno en el grupo")
+}
+
+func TestLaColaNoDemoraChatsDistintos(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	cola := enviador.nuevaCola()
+
+	inicio := enviador.reloj.ahora()
+	cola.Send(&tb.User{ID: 1}, "Hola")
+	cola.Send(&tb.User{ID: 2}, "Hola")
+	cola.Send(&tb.User{ID: 3}, "Hola")
+
+	assert.Equal(t, 2*limitesDePrueba.EntreMensajes, enviador.reloj.ahora().Sub(inicio), "Sólo debería esperar el límite general entre chats distintos")
+}
+
+func TestLaColaReintentaCuandoTelegramPideEsperar(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	enviador.floods = 1
+	cola := enviador.nuevaCola()
+
+	_, err := cola.Send(&tb.User{ID: 1}, "Hola")
+
+	assert.NoError(t, err, "Debería enviar el mensaje después de esperar")
+	envios := enviador.envios["1"]
+	assert.Len(t, envios, 2, "Debería haber intentado dos veces")
+	assert.Equal(t, time.Duration(enviador.esperaEn)*time.Second, envios[1].Sub(envios[0]), "Debería esperar lo que pidió Telegram")
+}
+
+func TestLaColaSeRindeSiTelegramSiguePidiendoEsperar(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	enviador.floods = 10
+	cola := enviador.nuevaCola()
+
+	_, err := cola.Send(&tb.User{ID: 1}, "Hola")
+
+	assert.Error(t, err, "Debería fallar si Telegram no deja de pedir esperar")
+	assert.Len(t, enviador.envios["1"], 4, "Debería haber intentado cuatro veces")
+}
+
+func TestLaColaSeVaciaCuandoTerminanLosTrabajos(t *testing.T) {
+	enviador := newEnviadorDePrueba()
+	cola := enviador.nuevaCola()
+
+	cola.EnSegundoPlano(func() {
+		for i := 0; i < 3; i++ {
+			cola.Send(&tb.Chat{ID: -1234}, "Hola")
+		}
+	})
+	err := cola.Vaciar(context.Background())
+
+	assert.NoError(t, err, "No debería fallar al vaciar")
+	assert.Len(t, enviador.envios["-1234"], 3, "Debería esperar a que se manden todos los mensajes")
+}
+
+func TestLaColaNoEsperaDeMasParaVaciarse(t *testing.T) {
+	cola := newEnviadorDePrueba().nuevaCola()
+	soltar := make(chan struct{})
+	defer close(soltar)
+	cola.EnSegundoPlano(func() {
+		<-soltar
+	})
+
+	ctx, cancelar := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelar()
+	err := cola.Vaciar(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Debería dejar de esperar cuando se acaba el plazo")
+}
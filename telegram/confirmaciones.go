@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const DuracionDeLasConfirmaciones = 2 * time.Minute
+
+type Confirmaciones struct {
+	duracion   time.Duration
+	mutex      sync.Mutex
+	pendientes map[string]*confirmacion
+}
+
+type confirmacion struct {
+	solicitante int
+	accion      func()
+	vence       time.Time
+}
+
+func NewConfirmaciones(duracion time.Duration) *Confirmaciones {
+	return &Confirmaciones{duracion: duracion, pendientes: make(map[string]*confirmacion)}
+}
+
+func (c *Confirmaciones) Nueva(solicitante int, accion func()) (string, error) {
+	aleatorio := make([]byte, 8)
+	_, err := rand.Read(aleatorio)
+	if err != nil {
+		return "", err
+	}
+	identificador := hex.EncodeToString(aleatorio)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ahora := time.Now()
+	for id, pendiente := range c.pendientes {
+		if pendiente.vence.Before(ahora) {
+			delete(c.pendientes, id)
+		}
+	}
+	c.pendientes[identificador] = &confirmacion{solicitante: solicitante, accion: accion, vence: ahora.Add(c.duracion)}
+
+	return identificador, nil
+}
+
+func (c *Confirmaciones) Confirmar(identificador string, solicitante int) (func(), error) {
+	pendiente, err := c.resolver(identificador, solicitante)
+	if err != nil {
+		return nil, err
+	}
+	return pendiente.accion, nil
+}
+
+func (c *Confirmaciones) Cancelar(identificador string, solicitante int) error {
+	_, err := c.resolver(identificador, solicitante)
+	return err
+}
+
+func (c *Confirmaciones) resolver(identificador string, solicitante int) (*confirmacion, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pendiente, existe := c.pendientes[identificador]
+	if !existe {
+		return nil, errors.New("confirmacionVencida")
+	}
+	if pendiente.solicitante != solicitante {
+		return nil, errors.New("noEsQuienPidio")
+	}
+
+	delete(c.pendientes, identificador)
+	if pendiente.vence.Before(time.Now()) {
+		return nil, errors.New("confirmacionVencida")
+	}
+	return pendiente, nil
+}
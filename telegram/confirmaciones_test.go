@@ -0,0 +1,65 @@
+package telegram_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/telegram"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSePuedeConfirmarUnaAccion(t *testing.T) {
+	confirmaciones := telegram.NewConfirmaciones(time.Minute)
+	ejecutada := false
+	identificador, err := confirmaciones.Nueva(123, func() { ejecutada = true })
+	assert.NoError(t, err, "No debería fallar al pedir la confirmación")
+
+	accion, err := confirmaciones.Confirmar(identificador, 123)
+
+	assert.NoError(t, err, "No debería fallar al confirmar")
+	accion()
+	assert.True(t, ejecutada, "Debería haber ejecutado la acción")
+}
+
+func TestSoloConfirmaQuienPidio(t *testing.T) {
+	confirmaciones := telegram.NewConfirmaciones(time.Minute)
+	identificador, _ := confirmaciones.Nueva(123, func() {})
+
+	accion, err := confirmaciones.Confirmar(identificador, 456)
+
+	assert.EqualError(t, err, "noEsQuienPidio", "Debería fallar si confirma otra persona")
+	assert.Nil(t, accion, "No debería devolver la acción")
+	_, err = confirmaciones.Confirmar(identificador, 123)
+	assert.NoError(t, err, "Quien pidió todavía puede confirmar")
+}
+
+func TestNoSePuedeConfirmarDosVeces(t *testing.T) {
+	confirmaciones := telegram.NewConfirmaciones(time.Minute)
+	identificador, _ := confirmaciones.Nueva(123, func() {})
+	confirmaciones.Confirmar(identificador, 123)
+
+	_, err := confirmaciones.Confirmar(identificador, 123)
+
+	assert.EqualError(t, err, "confirmacionVencida", "No debería confirmar dos veces")
+}
+
+func TestNoSePuedeConfirmarDespuesDeCancelar(t *testing.T) {
+	confirmaciones := telegram.NewConfirmaciones(time.Minute)
+	identificador, _ := confirmaciones.Nueva(123, func() {})
+
+	err := confirmaciones.Cancelar(identificador, 123)
+
+	assert.NoError(t, err, "No debería fallar al cancelar")
+	_, err = confirmaciones.Confirmar(identificador, 123)
+	assert.EqualError(t, err, "confirmacionVencida", "No debería confirmar lo que se canceló")
+}
+
+func TestLasConfirmacionesVencen(t *testing.T) {
+	confirmaciones := telegram.NewConfirmaciones(10 * time.Millisecond)
+	identificador, _ := confirmaciones.Nueva(123, func() {})
+	time.Sleep(20 * time.Millisecond)
+
+	_, err := confirmaciones.Confirmar(identificador, 123)
+
+	assert.EqualError(t, err, "confirmacionVencida", "No debería confirmar después de que venció")
+}
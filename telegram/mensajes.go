@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"strings"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// Telegram cuenta el largo en unidades de UTF-16
+const LargoMaximoDelMensaje = 4096
+
+// Parte el texto en mensajes que Telegram acepta, cortando entre líneas
+// siempre que se pueda
+func PartirMensaje(texto string) []string {
+	partes := make([]string, 0, 1)
+	parte := ""
+	largoDeLaParte := 0
+	for _, linea := range strings.SplitAfter(texto, "\n") {
+		largoDeLaLinea := largoEnTelegram(linea)
+		if largoDeLaParte+largoDeLaLinea > LargoMaximoDelMensaje && parte != "" {
+			partes = append(partes, parte)
+			parte, largoDeLaParte = "", 0
+		}
+		for largoDeLaLinea > LargoMaximoDelMensaje {
+			corte := cortarEn(linea, LargoMaximoDelMensaje)
+			partes = append(partes, linea[:corte])
+			linea = linea[corte:]
+			largoDeLaLinea = largoEnTelegram(linea)
+		}
+		parte += linea
+		largoDeLaParte += largoDeLaLinea
+	}
+	if strings.TrimSpace(parte) != "" || len(partes) == 0 {
+		partes = append(partes, parte)
+	}
+	return partes
+}
+
+// Si se parte un texto con HTML cada línea tiene que cerrar sus etiquetas
+func mandarEnPartes(cola *Cola, destino tb.Recipient, texto string, opciones ...interface{}) error {
+	for _, parte := range PartirMensaje(texto) {
+		_, err := cola.Send(destino, parte, opciones...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func largoEnTelegram(texto string) int {
+	largo := 0
+	for _, letra := range texto {
+		largo += largoDeLetra(letra)
+	}
+	return largo
+}
+
+func largoDeLetra(letra rune) int {
+	if letra > 0xFFFF {
+		return 2
+	}
+	return 1
+}
+
+// Devuelve hasta qué byte entra el largo sin cortar ninguna letra
+func cortarEn(texto string, largo int) int {
+	usado := 0
+	for posicion, letra := range texto {
+		if usado+largoDeLetra(letra) > largo {
+			return posicion
+		}
+		usado += largoDeLetra(letra)
+	}
+	return len(texto)
+}
+
+// Sugiere el mismo comando en cada uno de los juegos del grupo
+func ElegirJuego(nombreDelComando string, argumento string, juegos []string) string {
+	mensaje := "En este grupo hay varios juegos, decime en cuál con el nombre:\n"
+	for _, juego := range juegos {
+		mensaje += " * " + comando(comando(nombreDelComando, argumento), juego) + "\n"
+	}
+	return mensaje
+}
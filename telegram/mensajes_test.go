@@ -0,0 +1,59 @@
+package telegram_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/nickrisaro/invisible-bot/telegram"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnMensajeCortoVaEnUnaSolaParte(t *testing.T) {
+	assert.Equal(t, []string{"Estos son todos los juegos:\n * 1: Navidad\n"}, telegram.PartirMensaje("Estos son todos los juegos:\n * 1: Navidad\n"))
+}
+
+func TestUnMensajeLargoSeParteEntreLineas(t *testing.T) {
+	linea := " * " + strings.Repeat("a", 96) + "\n"
+	texto := strings.Repeat(linea, 100)
+
+	partes := telegram.PartirMensaje(texto)
+
+	assert.Len(t, partes, 3, "Deberían hacer falta tres mensajes")
+	assert.Equal(t, texto, strings.Join(partes, ""), "No debería perder nada")
+	for _, parte := range partes {
+		assert.LessOrEqual(t, len(parte), telegram.LargoMaximoDelMensaje, "Cada parte debería entrar en un mensaje")
+		assert.True(t, strings.HasSuffix(parte, "\n"), "Debería cortar entre líneas")
+	}
+}
+
+func TestUnaLineaLargaSeCortaSinRomperLetras(t *testing.T) {
+	texto := strings.Repeat("🎁", telegram.LargoMaximoDelMensaje)
+
+	partes := telegram.PartirMensaje(texto)
+
+	assert.Len(t, partes, 2, "Cada regalo ocupa dos unidades de UTF-16")
+	assert.Equal(t, texto, strings.Join(partes, ""), "No debería perder nada")
+	for _, parte := range partes {
+		assert.LessOrEqual(t, len(utf16.Encode([]rune(parte))), telegram.LargoMaximoDelMensaje, "Cada parte debería entrar en un mensaje")
+	}
+}
+
+func TestSugiereElComandoConSuArgumentoEnCadaJuego(t *testing.T) {
+	mensaje := telegram.ElegirJuego("/regalos", "2", []string{"Navidad", "Reyes"})
+
+	assert.Contains(t, mensaje, " * /regalos 2 Navidad\n", "Debería mantener la cantidad de regalos")
+	assert.Contains(t, mensaje, " * /regalos 2 Reyes\n", "Debería sugerir cada juego")
+}
+
+func TestSugiereElComandoSinArgumento(t *testing.T) {
+	mensaje := telegram.ElegirJuego("/sortear", "", []string{"Navidad"})
+
+	assert.Contains(t, mensaje, " * /sortear Navidad\n")
+}
+
+func TestSugiereElEquipoAntesDelPuntoYComa(t *testing.T) {
+	mensaje := telegram.ElegirJuego("/equipo", "Recursos Humanos;", []string{"Navidad"})
+
+	assert.Contains(t, mensaje, " * /equipo Recursos Humanos; Navidad\n")
+}
@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/metricas"
+)
+
+// Mide cuánto tardan los pedidos a Telegram. Las URLs son
+// https://api.telegram.org/bot<token>/<método>, así que sólo se usa el método
+type transporteMedido struct {
+	transporte http.RoundTripper
+}
+
+func (t *transporteMedido) RoundTrip(pedido *http.Request) (*http.Response, error) {
+	metodo := pedido.URL.Path[strings.LastIndex(pedido.URL.Path, "/")+1:]
+	inicio := time.Now()
+	respuesta, err := t.transporte.RoundTrip(pedido)
+
+	resultado := "ok"
+	if err != nil {
+		resultado = "error"
+	} else if respuesta.StatusCode != http.StatusOK {
+		resultado = fmt.Sprint(respuesta.StatusCode)
+	}
+	metricas.LatenciaDeTelegram.WithLabelValues(metodo, resultado).Observe(time.Since(inicio).Seconds())
+	return respuesta, err
+}
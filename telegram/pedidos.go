@@ -0,0 +1,216 @@
+package telegram
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/metricas"
+	"github.com/nickrisaro/invisible-bot/modelo"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const DuracionDeLosPedidos = 5 * time.Minute
+
+// Cada mensaje que llega es un pedido. Se guarda de qué actualización vino y
+// la bitácora con la que se loguea todo lo que pasa al atenderlo. Cada comando
+// se cuenta cuando termina con el error que anotó fallo, si anotó alguno, y
+// los que piden confirmación se cuentan cuando se confirman
+type pedido struct {
+	llegada            time.Time
+	registro           *bitacora.Bitacora
+	err                error
+	esperaConfirmacion bool
+}
+
+type pedidosEnCurso struct {
+	mutex      sync.Mutex
+	porMensaje map[*tb.Message]*pedido
+	porBoton   map[*tb.Callback]*bitacora.Bitacora
+	registro   *bitacora.Bitacora
+}
+
+func nuevosPedidos(registro *bitacora.Bitacora) *pedidosEnCurso {
+	return &pedidosEnCurso{porMensaje: make(map[*tb.Message]*pedido), porBoton: make(map[*tb.Callback]*bitacora.Bitacora), registro: registro}
+}
+
+// Cada mensaje y cada botón se guardan mientras se atienden, así todo lo que
+// se loguea lleva de qué actualización vino. Se olvidan con atendido, salvo
+// los comandos que esperan confirmación, que se olvidan con olvidarViejos
+func (p *pedidosEnCurso) recibir(u *tb.Update) {
+	if u.Message != nil {
+		p.nuevo(u.Message, p.registroDeMensaje(u.ID, u.Message))
+	}
+	if u.Callback != nil {
+		p.mutex.Lock()
+		p.porBoton[u.Callback] = p.registroDeBoton(u.ID, u.Callback)
+		p.mutex.Unlock()
+	}
+}
+
+func (p *pedidosEnCurso) atendido(u *tb.Update) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if u.Message != nil {
+		if pedidoEnCurso, existe := p.porMensaje[u.Message]; existe && !pedidoEnCurso.esperaConfirmacion {
+			delete(p.porMensaje, u.Message)
+		}
+	}
+	if u.Callback != nil {
+		delete(p.porBoton, u.Callback)
+	}
+}
+
+func (p *pedidosEnCurso) registroDeActualizacion(u *tb.Update) *bitacora.Bitacora {
+	if u.Message != nil {
+		return p.registroDeMensaje(u.ID, u.Message)
+	}
+	if u.Callback != nil {
+		return p.registroDeBoton(u.ID, u.Callback)
+	}
+	return p.registro.Con("actualizacion", u.ID)
+}
+
+func (p *pedidosEnCurso) registroDeBoton(actualizacion int, c *tb.Callback) *bitacora.Bitacora {
+	registroDelBoton := p.registro.Con("actualizacion", actualizacion)
+	if c.Message != nil && c.Message.Chat != nil {
+		registroDelBoton = registroDelBoton.Con("chat", c.Message.Chat.ID)
+	}
+	if c.Sender != nil {
+		registroDelBoton = registroDelBoton.Con("usuario", c.Sender.ID).ConNombre("nombre", modelo.NombreCompleto(c.Sender.FirstName, c.Sender.LastName))
+	}
+	return registroDelBoton
+}
+
+func (p *pedidosEnCurso) registroDeMensaje(actualizacion int, m *tb.Message) *bitacora.Bitacora {
+	registroDelPedido := p.registro.Con("actualizacion", actualizacion).Con("chat", m.Chat.ID)
+	if m.Sender != nil {
+		registroDelPedido = registroDelPedido.Con("usuario", m.Sender.ID).ConNombre("nombre", modelo.NombreCompleto(m.Sender.FirstName, m.Sender.LastName))
+	}
+	if strings.HasPrefix(m.Text, "/") {
+		registroDelPedido = registroDelPedido.Con("comando", nombreDelComando(m))
+	}
+	return registroDelPedido
+}
+
+func (p *pedidosEnCurso) nuevo(m *tb.Message, registroDelPedido *bitacora.Bitacora) *pedido {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	nuevo := &pedido{llegada: time.Now(), registro: registroDelPedido}
+	p.porMensaje[m] = nuevo
+	return nuevo
+}
+
+func (p *pedidosEnCurso) olvidarViejos(ahora time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for mensaje, viejo := range p.porMensaje {
+		if ahora.Sub(viejo.llegada) > DuracionDeLosPedidos {
+			delete(p.porMensaje, mensaje)
+		}
+	}
+}
+
+func (p *pedidosEnCurso) olvidarViejosCadaTanto(parar <-chan struct{}) {
+	ticker := time.NewTicker(DuracionDeLosPedidos)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-parar:
+			return
+		case ahora := <-ticker.C:
+			p.olvidarViejos(ahora)
+		}
+	}
+}
+
+func (p *pedidosEnCurso) buscar(m *tb.Message) (*pedido, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	encontrado, existe := p.porMensaje[m]
+	return encontrado, existe
+}
+
+func manejarComando(b *tb.Bot, pedidos *pedidosEnCurso, nombre string, manejador func(m *tb.Message)) {
+	b.Handle(nombre, func(m *tb.Message) {
+		pedidos.medir(nombre, m, func() {
+			manejador(m)
+		})
+	})
+}
+
+func (p *pedidosEnCurso) medir(nombre string, m *tb.Message, accion func()) {
+	pedidoEnCurso, existe := p.buscar(m)
+	if !existe {
+		pedidoEnCurso = p.nuevo(m, p.registroDeMensaje(0, m))
+	}
+	p.mutex.Lock()
+	pedidoEnCurso.err = nil
+	pedidoEnCurso.esperaConfirmacion = false
+	p.mutex.Unlock()
+
+	inicio := time.Now()
+	accion()
+
+	p.mutex.Lock()
+	err, esperaConfirmacion := pedidoEnCurso.err, pedidoEnCurso.esperaConfirmacion
+	if !esperaConfirmacion {
+		delete(p.porMensaje, m)
+	}
+	p.mutex.Unlock()
+
+	if esperaConfirmacion {
+		pedidoEnCurso.registro.Depurar("Esperando confirmación")
+		return
+	}
+	metricas.Comandos.WithLabelValues(nombre, metricas.Resultado(err)).Inc()
+	pedidoEnCurso.registro.Con("resultado", metricas.Resultado(err)).Con("duracion_ms", time.Since(inicio).Milliseconds()).Informar("Comando atendido")
+}
+
+func (p *pedidosEnCurso) registroDe(m *tb.Message) *bitacora.Bitacora {
+	pedidoEnCurso, existe := p.buscar(m)
+	if !existe {
+		return p.registroDeMensaje(0, m)
+	}
+	return pedidoEnCurso.registro
+}
+
+func (p *pedidosEnCurso) registroDelBoton(c *tb.Callback) *bitacora.Bitacora {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	registroDelBoton, existe := p.porBoton[c]
+	if !existe {
+		return p.registroDeBoton(0, c)
+	}
+	return registroDelBoton
+}
+
+func (p *pedidosEnCurso) fallo(m *tb.Message, err error, mensaje string) {
+	p.registroDe(m).Error(mensaje, err)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if pedidoEnCurso, existe := p.porMensaje[m]; existe {
+		pedidoEnCurso.err = err
+	}
+}
+
+func (p *pedidosEnCurso) esperarConfirmacion(m *tb.Message) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if pedidoEnCurso, existe := p.porMensaje[m]; existe {
+		pedidoEnCurso.esperaConfirmacion = true
+	}
+}
+
+func nombreDelComando(m *tb.Message) string {
+	palabras := strings.Fields(m.Text)
+	if len(palabras) == 0 {
+		return ""
+	}
+	return strings.SplitN(palabras[0], "@", 2)[0]
+}
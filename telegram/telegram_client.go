@@ -2,215 +2,1337 @@ package telegram
 
 import (
 	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/nickrisaro/invisible-bot/bitacora"
+	"github.com/nickrisaro/invisible-bot/config"
 	"github.com/nickrisaro/invisible-bot/lamaga"
+	"github.com/nickrisaro/invisible-bot/metricas"
 	"github.com/nickrisaro/invisible-bot/modelo"
+	"github.com/nickrisaro/invisible-bot/pagina"
 
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
-func Configurar(urlPublica string, urlPrivada string, token string, maga *lamaga.LaMaga) (*tb.Bot, error) {
+// El webhook no escucha por su cuenta, lo atiende el servidor junto con el resto de las rutas.
+// Con enlaces /misamigxs también manda un enlace a la página de amigxs
+func Configurar(configuracion *config.Config, maga *lamaga.LaMaga, enlaces *pagina.Firmador, registroDelBot *bitacora.Bitacora) (*Bot, error) {
+	pedidos := nuevosPedidos(registroDelBot)
+	var webhook *tb.Webhook
+	var poller tb.Poller = &tb.LongPoller{Timeout: configuracion.IntervaloDePolling}
+	if configuracion.Modo == config.ModoWebhook {
+		webhook = &tb.Webhook{Endpoint: &tb.WebhookEndpoint{PublicURL: configuracion.URLPublica, Cert: ""}}
+		poller = webhook
+	}
+	// Cada actualización se atiende en su goroutine desde Bot.Start, así que
+	// telebot puede llamar a los manejadores de forma sincrónica
 	b, err := tb.NewBot(tb.Settings{
-		Token:  token,
-		Poller: &tb.Webhook{Listen: urlPrivada, Endpoint: &tb.WebhookEndpoint{PublicURL: urlPublica, Cert: ""}},
+		Token:       configuracion.Token,
+		Client:      &http.Client{Timeout: time.Minute + configuracion.IntervaloDePolling, Transport: &transporteMedido{transporte: http.DefaultTransport}},
+		Poller:      poller,
+		Synchronous: true,
 	})
 
 	if err != nil {
-		fmt.Println("Error al configurar", err)
+		registroDelBot.Error("Error al configurar", err)
 		return nil, err
 	}
 
-	b.Handle("/ping", func(m *tb.Message) {
-		b.Send(m.Chat, "Pong!")
+	// Telegram no manda actualizaciones por polling si hay un webhook configurado
+	if configuracion.Modo == config.ModoPolling {
+		err = b.RemoveWebhook()
+		if err != nil {
+			registroDelBot.Error("Error al sacar el webhook", err)
+			return nil, err
+		}
+	}
+
+	cola := NewCola(b, NewLimites(configuracion.MensajesPorSegundo, configuracion.MensajesPorSegundoPrivado, configuracion.MensajesPorMinutoEnGrupos))
+	cola.UsarBitacora(registroDelBot)
+	confirmaciones := NewConfirmaciones(DuracionDeLasConfirmaciones)
+
+	b.Handle(&botonConfirmar, func(c *tb.Callback) {
+		responderConfirmacion(cola, pedidos, confirmaciones, c, true)
+	})
+
+	b.Handle(&botonCancelar, func(c *tb.Callback) {
+		responderConfirmacion(cola, pedidos, confirmaciones, c, false)
+	})
+
+	b.Handle(tb.OnNewGroupTitle, func(m *tb.Message) {
+		err := maga.Renombrar(m.Chat.ID, m.NewGroupTitle)
+		if err != nil {
+			pedidos.registroDe(m).Error("Error al renombrar grupo", err)
+		}
+	})
+
+	b.Handle(tb.OnUserLeft, func(m *tb.Message) {
+		avisarSalidas(cola, pedidos, maga, m)
 	})
 
-	b.Handle("/start", func(m *tb.Message) {
-		b.Send(m.Chat, "Hola soy La Maga, si querés jugar al amigo, amiga, amigue, amigx invisble yo te puedo ayudar")
-		b.Send(m.Chat, "Si ya estás jugando en un grupo te voy a avisar por acá a quién le tenés que regalar algo")
-		b.Send(m.Chat, "Si todavía no estás jugando, agregame en alguno de tus grupos y empezá el juego!")
-		b.Send(m.Chat, "Si querés ver en que grupos estás jugando mandá /misgrupos y si querés ver a quién le tenés que regalar mandá /misamigxs")
+	manejarComando(b, pedidos, "/ping", func(m *tb.Message) {
+		cola.Send(m.Chat, "Pong!")
 	})
 
-	b.Handle("/help", func(m *tb.Message) {
+	manejarComando(b, pedidos, "/start", func(m *tb.Message) {
+		cola.Send(m.Chat, "Hola soy La Maga, si querés jugar al amigo, amiga, amigue, amigx invisble yo te puedo ayudar")
+		cola.Send(m.Chat, "Si ya estás jugando en un grupo te voy a avisar por acá a quién le tenés que regalar algo")
+		cola.Send(m.Chat, "Si todavía no estás jugando, agregame en alguno de tus grupos y empezá el juego!")
+		cola.Send(m.Chat, "Si querés ver en que grupos estás jugando mandá /misgrupos y si querés ver a quién le tenés que regalar mandá /misamigxs")
+
+		if !m.Private() {
+			return
+		}
+		notificaciones, err := maga.NotificacionesPendientesDe(m.Sender.ID)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al buscar notificaciones pendientes")
+			return
+		}
+		for _, notificacion := range notificaciones {
+			notificar(cola, maga, notificacion.Participante, notificacion.Grupo)
+		}
+	})
+
+	manejarComando(b, pedidos, "/help", func(m *tb.Message) {
 		ayuda := "Hola soy La Maga, si querés jugar al amigo, amiga, amigue, amigx invisble yo te puedo ayudar\n"
 		ayuda += "Para empezar mandá el comando /comenzar así preparo todo\n"
+		ayuda += "Si querés jugar más de un juego en el mismo grupo ponele nombre a cada uno, por ejemplo /comenzar Navidad 2026, y agregá el nombre a los demás comandos, por ejemplo /sumame Navidad 2026\n"
 		ayuda += "Cada persona que quiera participar tiene que mandar /sumame\n"
+		ayuda += "Si juegan por equipos cada persona puede mandar /equipo Nombre (o /equipo Nombre; Navidad 2026 si hay varios juegos) y quien organiza elegir con /equipos distintos o /equipos mismo si le regalan a otro equipo o al propio\n"
+		ayuda += "Si querés que cada persona haga más de un regalo mandá /regalos 2 antes de sortear\n"
+		ayuda += "Si alguien no tiene Telegram quien organiza lo puede agregar con /agregar Nombre y te mando su amigx a vos (o a quien quieras con /agregar Nombre @usuario)\n"
+		ayuda += "Si jugás con personas a tu cargo, como tus hijxs, sumalas con /sumar Nombre y te mando sus amigxs a vos. Por defecto no se regalan entre sí, quien organiza lo puede cambiar con /hermanxs si\n"
 		ayuda += "Cuando todas las personas se hayan sumado mandá /sortear\n"
+		ayuda += "Si querés saber quiénes todavía no recibieron su amigx mandá /estado\n"
+		ayuda += "Cuando tengas el regalo para tu amigx mandá /listo y cuando recibas el tuyo mandá /recibi, quien organiza puede ver cómo vamos con /progreso\n"
+		ayuda += "Quien organiza puede decir cuánto gastar con /presupuesto hasta $5000 y cada persona puede contar qué le gustaría recibir con /deseos un libro, se lo muestro a quien le regala con /misamigxs\n"
+		ayuda += "Para avisar cuándo es el intercambio mandá /fecha 24/12/2026 y ese día mandá /revelar para contar quién le regaló a quién (o /revelar suspenso para contarlo de a poco)\n"
+		ayuda += "Antes de revelar podés adivinar quién te regala mandándome /adivinar @usuario por privado\n"
+		ayuda += "Quien organiza puede ver todo lo que pasó en el juego con /registro\n"
+		ayuda += "Cuando termine el juego mandá /terminar, los juegos terminados los podés ver con /historial y borrar para siempre con /purgar\n"
 		ayuda += "Si querés ver en que grupos estás jugando mandá /misgrupos (lo podés mandar en un grupo y la respuesta te llega sólo a vos)\n"
 		ayuda += "Si querés ver a quién le tenés que regalar mandá /misamigxs (lo podés mandar en un grupo y la respuesta te llega sólo a vos)\n"
-		b.Send(m.Chat, ayuda)
+		cola.Send(m.Chat, ayuda)
 	})
 
-	b.Handle("/comenzar", func(m *tb.Message) {
+	manejarComando(b, pedidos, "/comenzar", func(m *tb.Message) {
 		if !m.FromGroup() {
-			b.Send(m.Chat, "No podés comenzar en un chat privado, agregame a un grupo con tus amigxs y mandá /comenzar ahí")
+			cola.Send(m.Chat, "No podés comenzar en un chat privado, agregame a un grupo con tus amigxs y mandá /comenzar ahí")
 			return
 		}
-		nombreDelGrupo := m.Chat.Title
-		if len(nombreDelGrupo) == 0 {
-			nombreDelGrupo = m.Chat.FirstName + " " + m.Chat.LastName
-		}
-		err := maga.NuevoGrupo(m.Chat.ID, nombreDelGrupo)
+		nombreDelGrupo := nombreDelChat(m.Chat)
+		err := maga.NuevoGrupo(m.Chat.ID, m.Payload, nombreDelGrupo, m.Sender.ID)
 		if err != nil {
-			fmt.Println("Error al crear grupo", err)
-			b.Send(m.Chat, "Ups, no pude crear tu grupo, probá más tarde")
+			pedidos.fallo(m, err, "Error al crear grupo")
+			if err.Error() == "ya existe ese grupo" {
+				cola.Send(m.Chat, "Ya hay un juego con ese nombre en este grupo, si querés jugar otro ponele un nombre distinto, por ejemplo /comenzar Navidad 2026")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude crear tu grupo, probá más tarde")
+			}
 		} else {
-			b.Send(m.Chat, "Listo, ya creé tu grupo, ahora cada persona que quiera jugar tiene que mandar /sumame")
+			cola.Send(m.Chat, "Listo, ya creé tu grupo, ahora cada persona que quiera jugar tiene que mandar "+comando("/sumame", m.Payload))
 		}
 	})
 
-	b.Handle("/sumame", func(m *tb.Message) {
-		nombreDelGrupo := m.Chat.Title
-		if len(nombreDelGrupo) == 0 {
-			nombreDelGrupo = m.Chat.FirstName + " " + m.Chat.LastName
-		}
-		nombreCompletoParticipante := m.Sender.FirstName + " " + m.Sender.LastName
-		username := nombreCompletoParticipante
-		if len(m.Sender.Username) > 0 {
-			username = m.Sender.Username
+	manejarComando(b, pedidos, "/sumame", func(m *tb.Message) {
+		nombreCompletoParticipante := modelo.NombreCompleto(m.Sender.FirstName, m.Sender.LastName)
+		err := maga.NuevoParticipante(m.Chat.ID, m.Payload, m.Sender.ID, nombreCompletoParticipante)
+		if err == nil {
+			err = maga.ActualizarIdentidad(m.Sender.ID, m.Sender.Username, m.Sender.FirstName, m.Sender.LastName)
 		}
-		err := maga.NuevoParticipante(m.Chat.ID, m.Sender.ID, nombreCompletoParticipante)
 		if err != nil {
-			fmt.Println("Error al agregar persona al grupo", err)
-			b.Send(m.Chat, "Ups, no pude agregar a la persona al grupo ¿Ya creaste el grupo con /comenzar ?")
+			pedidos.fallo(m, err, "Error al agregar persona al grupo")
+			if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude agregar a la persona al grupo ¿Ya creaste el grupo con /comenzar ?")
+			}
 		} else {
-			_, err = b.Send(m.Sender, "Hola, te anoté para jugar al amigx invisible en el grupo "+nombreDelGrupo+". Cuando hagan el sorteo te voy a avisar a quién le tenés que regalar algo.")
+			mencionDelParticipante := mencion(m.Sender.ID, nombreCompletoParticipante)
+			_, err = cola.Send(m.Sender, "Hola, te anoté para jugar al amigx invisible en el grupo "+tituloDelJuego(maga, m)+". Cuando hagan el sorteo te voy a avisar a quién le tenés que regalar algo.")
 			if err != nil {
-				b.Send(m.Chat, "@"+username+" no te puedo mandar mensajes, me tenés que hablar vos primero, andá a @amigxinvisiblebot y tocá Start")
+				cola.Send(m.Chat, mencionDelParticipante+" no te puedo mandar mensajes, me tenés que hablar vos primero, andá a @amigxinvisiblebot y tocá Start", tb.ModeHTML)
 			}
-			b.Send(m.Chat, "Listo, ya agregué a @"+username+" al grupo.\nSi ya se sumaron todas las personas mandá /sortear\nSi querés ver quienes se sumaron mandá /listar")
+			cola.Send(m.Chat, "Listo, ya agregué a "+mencionDelParticipante+" al grupo.\nSi ya se sumaron todas las personas mandá "+html.EscapeString(comando("/sortear", m.Payload))+"\nSi querés ver quienes se sumaron mandá "+html.EscapeString(comando("/listar", m.Payload)), tb.ModeHTML)
 		}
 	})
 
-	b.Handle("/listar", func(m *tb.Message) {
-		participantes, err := maga.QuienesParticipan(m.Chat.ID)
+	manejarComando(b, pedidos, "/agregar", func(m *tb.Message) {
+		persona, juego := separarJuego(m.Payload)
+		nombre, responsable := persona, ""
+		if palabras := strings.Fields(persona); len(palabras) > 1 && strings.HasPrefix(palabras[len(palabras)-1], "@") {
+			responsable = palabras[len(palabras)-1]
+			nombre = strings.Join(palabras[:len(palabras)-1], " ")
+		}
+		if len(nombre) == 0 {
+			cola.Send(m.Chat, "Decime el nombre de la persona que no tiene Telegram, por ejemplo /agregar Abuela Rosa\nSi querés que su amigx le llegue a otra persona que juega agregá su usuario, por ejemplo /agregar Abuela Rosa @usuario")
+			return
+		}
+
+		err := maga.NuevoParticipanteSinTelegram(m.Chat.ID, juego, m.Sender.ID, nombre, responsable)
 		if err != nil {
-			fmt.Println("Error al listar participantes", err)
-			b.Send(m.Chat, "Ups, no pude encontrar a las personas que participan ¿Ya creaste el grupo con /comenzar ?")
+			pedidos.fallo(m, err, "Error al agregar persona sin Telegram")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede agregar personas sin Telegram")
+			} else if err.Error() == "yaSorteado" {
+				cola.Send(m.Chat, "Ya hice el sorteo, no se pueden agregar personas")
+			} else if err.Error() == "yaParticipa" {
+				cola.Send(m.Chat, nombre+" ya está participando")
+			} else if err.Error() == "responsableNoEncontrado" {
+				cola.Send(m.Chat, "No encontré a "+responsable+" jugando, tiene que sumarse con /sumame antes")
+			} else if err.Error() == "juegoAmbiguo" {
+				cola.Send(m.Chat, "En este grupo hay varios juegos, decime en cuál después de un punto y coma, por ejemplo /agregar "+nombre+"; Navidad 2026")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude agregar a la persona al grupo ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+
+		quienRecibe := "a vos"
+		if len(responsable) > 0 {
+			quienRecibe = "a " + responsable
+		}
+		cola.Send(m.Chat, "Listo, ya agregué a "+nombre+" al grupo. Cuando haga el sorteo le voy a mandar "+quienRecibe+" a quién le tiene que regalar algo")
+	})
+
+	manejarComando(b, pedidos, "/sumar", func(m *tb.Message) {
+		if !m.FromGroup() {
+			cola.Send(m.Chat, "Mandá este comando en el grupo donde estás jugando")
+			return
+		}
+		nombre, juego := separarJuego(m.Payload)
+		if len(nombre) == 0 {
+			cola.Send(m.Chat, "Decime el nombre de la persona que querés sumar a tu cargo, por ejemplo /sumar Juani")
+			return
+		}
+
+		err := maga.NuevoParticipanteACargo(m.Chat.ID, juego, m.Sender.ID, nombre)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al agregar persona a cargo")
+			if err.Error() == "yaSorteado" {
+				cola.Send(m.Chat, "Ya hice el sorteo, no se pueden agregar personas")
+			} else if err.Error() == "yaParticipa" {
+				cola.Send(m.Chat, nombre+" ya está participando")
+			} else if err.Error() == "juegoAmbiguo" {
+				cola.Send(m.Chat, "En este grupo hay varios juegos, decime en cuál después de un punto y coma, por ejemplo /sumar "+nombre+"; Navidad 2026")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude agregar a la persona al grupo ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+
+		cola.Send(m.Chat, "Listo, ya sumé a "+html.EscapeString(nombre)+" a cargo de "+mencion(m.Sender.ID, m.Sender.FirstName)+". Cuando haga el sorteo te mando a quién le tiene que regalar algo", tb.ModeHTML)
+	})
+
+	manejarComando(b, pedidos, "/hermanxs", func(m *tb.Message) {
+		opcion, juego := primeraPalabra(m.Payload)
+		opcion = strings.ToLower(opcion)
+		if opcion != "si" && opcion != "sí" && opcion != "no" {
+			cola.Send(m.Chat, "Decime si quienes comparten cuenta se pueden regalar entre sí, por ejemplo /hermanxs si o /hermanxs no")
+			return
+		}
+		sePuedenRegalar := opcion != "no"
+
+		err := maga.DefinirHermanxs(m.Chat.ID, juego, m.Sender.ID, sePuedenRegalar)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al definir si se regalan entre hermanxs")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede cambiar cómo se sortea")
+			} else if err.Error() == "yaSorteado" {
+				cola.Send(m.Chat, "Ya hice el sorteo, no se puede cambiar cómo se sortea")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, opcion)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude cambiar cómo se sortea ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		if sePuedenRegalar {
+			cola.Send(m.Chat, "Listo, quienes comparten cuenta se pueden regalar entre sí")
+		} else {
+			cola.Send(m.Chat, "Listo, quienes comparten cuenta no se van a regalar entre sí")
+		}
+	})
+
+	manejarComando(b, pedidos, "/listar", func(m *tb.Message) {
+		participantes, err := maga.QuienesParticipan(m.Chat.ID, m.Payload)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al listar participantes")
+			if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude encontrar a las personas que participan ¿Ya creaste el grupo con /comenzar ?")
+			}
 		} else {
 			if len(participantes) == 0 {
-				b.Send(m.Chat, "Todavía no se anotó nadie, se pueden sumar al juego con /sumame")
+				cola.Send(m.Chat, "Todavía no se anotó nadie, se pueden sumar al juego con "+comando("/sumame", m.Payload))
 			} else {
 				listaDeParticipantes := "Ya se anotaron para jugar:\n"
 				for _, participante := range participantes {
 					listaDeParticipantes += " * " + participante + "\n"
 				}
-				b.Send(m.Chat, listaDeParticipantes)
+				cola.Send(m.Chat, listaDeParticipantes)
 			}
 		}
 	})
 
-	b.Handle("/sortear", func(m *tb.Message) {
-		sorteados, err := maga.Sortear(m.Chat.ID)
-		nombreDelGrupo := m.Chat.Title
-		if len(nombreDelGrupo) == 0 {
-			nombreDelGrupo = m.Chat.FirstName + " " + m.Chat.LastName
+	manejarComando(b, pedidos, "/sortear", func(m *tb.Message) {
+		pedirConfirmacion(cola, pedidos, confirmaciones, m, "¿Hago el sorteo"+enElJuego(m.Payload)+"? Después no se puede deshacer", func() {
+			sorteados, err := maga.ConBitacora(pedidos.registroDe(m)).Sortear(m.Chat.ID, m.Payload, m.Sender.ID)
+
+			if err != nil {
+				pedidos.fallo(m, err, "Error al sortear")
+				if err.Error() == "faltanParticipantes" {
+					cola.Send(m.Chat, "Necesito al menos dos personas para poder sortear, y si cada une hace varios regalos una persona más que la cantidad de regalos")
+				} else if err.Error() == "sorteoImposible" {
+					cola.Send(m.Chat, "Con estos equipos y familias no hay forma de sortear, cambien algún equipo con /equipo, la regla con /equipos o dejen que se regalen entre hermanxs con /hermanxs si")
+				} else if err.Error() == "yaSorteado" {
+					cola.Send(m.Chat, "Ya hice el sorteo en este grupo, si querés que vuelva a notificar mandá "+comando("/notificar", m.Payload))
+				} else if err.Error() == "juegoAmbiguo" {
+					avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+				} else {
+					cola.Send(m.Chat, "Ups, no pude sortear ¿Ya creaste el grupo con /comenzar ?")
+				}
+			} else {
+				mandarMensajes(cola, maga, m.Chat, sorteados, tituloDelJuego(maga, m))
+				publicarCompromiso(cola, pedidos, maga, m)
+			}
+		})
+	})
+
+	manejarComando(b, pedidos, "/notificar", func(m *tb.Message) {
+		sorteados, err := maga.Renotificar(m.Chat.ID, m.Payload, m.Sender.ID)
+
+		if err != nil {
+			pedidos.fallo(m, err, "Error al notificar")
+			if err.Error() == "noSorteado" {
+				cola.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá "+comando("/sortear", m.Payload))
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude mandar los mensajes ¿Ya creaste el grupo con /comenzar y sorteaste con /sortear ?")
+			}
+		} else {
+			mandarMensajes(cola, maga, m.Chat, sorteados, tituloDelJuego(maga, m))
+		}
+	})
+
+	manejarComando(b, pedidos, "/reenlazar", func(m *tb.Message) {
+		pedirConfirmacion(cola, pedidos, confirmaciones, m, "¿Reenlazo las cadenas de quienes se fueron"+enElJuego(m.Payload)+"? Algunas personas van a cambiar de amigx", func() {
+			reenlazados, err := maga.ConBitacora(pedidos.registroDe(m)).Reenlazar(m.Chat.ID, m.Payload, m.Sender.ID)
+			if err != nil {
+				pedidos.fallo(m, err, "Error al reenlazar")
+				if err.Error() == "noEsOrganizador" {
+					cola.Send(m.Chat, "Sólo quien organiza el juego puede reenlazar")
+				} else if err.Error() == "noSorteado" {
+					cola.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá "+comando("/sortear", m.Payload))
+				} else if err.Error() == "noSePuedeReenlazar" {
+					cola.Send(m.Chat, "No quedan suficientes personas para reenlazar, si quieren seguir jugando manden "+comando("/terminar", m.Payload)+" y empiecen de nuevo")
+				} else if err.Error() == "juegoAmbiguo" {
+					avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+				} else {
+					cola.Send(m.Chat, "Ups, no pude reenlazar ¿Ya creaste el grupo con /comenzar ?")
+				}
+				return
+			}
+
+			if len(reenlazados) == 0 {
+				cola.Send(m.Chat, "No hay nada para reenlazar, nadie se fue del grupo después del sorteo")
+				return
+			}
+			mandarMensajes(cola, maga, m.Chat, reenlazados, tituloDelJuego(maga, m))
+		})
+	})
+
+	manejarComando(b, pedidos, "/equipo", func(m *tb.Message) {
+		if !m.FromGroup() {
+			cola.Send(m.Chat, "Mandá este comando en el grupo donde estás jugando")
+			return
+		}
+		equipo, juego := separarJuego(m.Payload)
+		if len(equipo) == 0 {
+			cola.Send(m.Chat, "Decime en qué equipo estás, por ejemplo /equipo Recursos Humanos")
+			return
 		}
 
+		err := maga.DefinirEquipo(m.Chat.ID, juego, m.Sender.ID, equipo)
 		if err != nil {
-			fmt.Println("Error al sortear", err)
-			if err.Error() == "faltanParticipantes" {
-				b.Send(m.Chat, "Necesito al menos dos personas para poder sortear")
+			pedidos.fallo(m, err, "Error al definir el equipo")
+			if err.Error() == "noParticipa" {
+				cola.Send(m.Chat, "No estás participando"+enElJuego(juego)+", si querés participar mandá "+comando("/sumame", juego))
 			} else if err.Error() == "yaSorteado" {
-				b.Send(m.Chat, "Ya hice el sorteo en este grupo, si querés que vuelva a notificar mandá /notificar")
+				cola.Send(m.Chat, "Ya hice el sorteo, no se pueden cambiar los equipos")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, equipo+";")
 			} else {
-				b.Send(m.Chat, "Ups, no pude sortear ¿Ya creaste el grupo con /comenzar ?")
+				cola.Send(m.Chat, "Ups, no pude anotar tu equipo ¿Ya creaste el grupo con /comenzar ?")
 			}
+			return
+		}
+		cola.Send(m.Chat, "Listo "+mencion(m.Sender.ID, m.Sender.FirstName)+", anoté que estás en el equipo "+html.EscapeString(equipo), tb.ModeHTML)
+	})
+
+	manejarComando(b, pedidos, "/equipos", func(m *tb.Message) {
+		opcion, juego := primeraPalabra(m.Payload)
+		regla, existe := reglasDeEquipos[strings.ToLower(opcion)]
+		if !existe {
+			cola.Send(m.Chat, "Decime cómo sorteo con los equipos:\n * /equipos distintos para regalarle a alguien de otro equipo\n * /equipos mismo para regalarle a alguien del mismo equipo\n * /equipos libre para no tener en cuenta los equipos")
+			return
+		}
+
+		err := maga.DefinirReglaDeEquipos(m.Chat.ID, juego, m.Sender.ID, regla)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al definir la regla de equipos")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede cambiar cómo se sortea")
+			} else if err.Error() == "yaSorteado" {
+				cola.Send(m.Chat, "Ya hice el sorteo, no se puede cambiar cómo se sortea")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, opcion)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude cambiar cómo se sortea ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		cola.Send(m.Chat, "Listo, para el sorteo"+enElJuego(juego)+" "+descripcionDeReglas[regla])
+	})
+
+	manejarComando(b, pedidos, "/regalos", func(m *tb.Message) {
+		textoDeLaCantidad, juego := primeraPalabra(m.Payload)
+		regalos, err := strconv.Atoi(textoDeLaCantidad)
+		if err != nil || regalos < 1 {
+			cola.Send(m.Chat, "Decime cuántos regalos hace cada persona, por ejemplo /regalos 2")
+			return
+		}
+
+		err = maga.DefinirRegalosPorPersona(m.Chat.ID, juego, m.Sender.ID, regalos)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al definir los regalos por persona")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede cambiar cuántos regalos hace cada persona")
+			} else if err.Error() == "yaSorteado" {
+				cola.Send(m.Chat, "Ya hice el sorteo, no se puede cambiar cuántos regalos hace cada persona")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, textoDeLaCantidad)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude cambiar cuántos regalos hace cada persona ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		if regalos == 1 {
+			cola.Send(m.Chat, "Listo, cada persona"+enElJuego(juego)+" hace un regalo")
 		} else {
-			mandarMensajes(b, m.Chat, sorteados, nombreDelGrupo)
+			cola.Send(m.Chat, "Listo, cada persona"+enElJuego(juego)+" hace "+strconv.Itoa(regalos)+" regalos y recibe otros tantos")
+		}
+	})
+
+	manejarComando(b, pedidos, "/fecha", func(m *tb.Message) {
+		textoDeLaFecha, juego := primeraPalabra(m.Payload)
+		fecha, err := time.ParseInLocation(FormatoDeFecha, textoDeLaFecha, time.Local)
+		if err != nil {
+			cola.Send(m.Chat, "Decime la fecha del intercambio así: /fecha 24/12/2026")
+			return
+		}
+
+		err = maga.DefinirFecha(m.Chat.ID, juego, m.Sender.ID, fecha)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al definir la fecha")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede cambiar la fecha")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, textoDeLaFecha)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude guardar la fecha ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		cola.Send(m.Chat, "Listo, el intercambio es el "+fecha.Format(FormatoDeFecha)+", ese día pueden mandar "+comando("/revelar", juego)+" para ver quién le regaló a quién")
+	})
+
+	manejarComando(b, pedidos, "/presupuesto", func(m *tb.Message) {
+		presupuesto, juego := separarJuego(m.Payload)
+		if len(presupuesto) == 0 {
+			cola.Send(m.Chat, "Decime cuánto se puede gastar en cada regalo, por ejemplo /presupuesto hasta $5000")
+			return
+		}
+
+		err := maga.DefinirPresupuesto(m.Chat.ID, juego, m.Sender.ID, presupuesto)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al definir el presupuesto")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede cambiar el presupuesto")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, presupuesto+";")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude guardar el presupuesto ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		cola.Send(m.Chat, "Listo, el presupuesto"+enElJuego(juego)+" es "+presupuesto)
+	})
+
+	manejarComando(b, pedidos, "/deseos", func(m *tb.Message) {
+		if !m.FromGroup() {
+			cola.Send(m.Chat, "Mandá este comando en el grupo donde estás jugando")
+			return
+		}
+		deseos, juego := separarJuego(m.Payload)
+		if len(deseos) == 0 {
+			cola.Send(m.Chat, "Contame qué te gustaría recibir, por ejemplo /deseos un libro de cuentos o unas medias")
+			return
+		}
+
+		err := maga.DefinirDeseos(m.Chat.ID, juego, m.Sender.ID, deseos)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al anotar los deseos")
+			if err.Error() == "noParticipa" {
+				cola.Send(m.Chat, "No estás participando"+enElJuego(juego)+", si querés participar mandá "+comando("/sumame", juego))
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, deseos+";")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude anotar lo que te gustaría ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+		cola.Send(m.Chat, "Listo "+mencion(m.Sender.ID, m.Sender.FirstName)+", se lo voy a mostrar a quien te regale cuando mande /misamigxs", tb.ModeHTML)
+	})
+
+	manejarComando(b, pedidos, "/revelar", func(m *tb.Message) {
+		opcion, juego := primeraPalabra(m.Payload)
+		conSuspenso := opcion == "suspenso"
+		if !conSuspenso {
+			opcion, juego = "", m.Payload
+		}
+
+		revelar := func(forzar bool) error {
+			revelados, err := maga.Revelar(m.Chat.ID, juego, m.Sender.ID, time.Now(), forzar)
+			if err != nil {
+				return err
+			}
+			adivinanzas, err := maga.Adivinanzas(m.Chat.ID, juego)
+			if err != nil {
+				pedidos.registroDe(m).Error("Error al buscar adivinanzas", err)
+			}
+			grupo, err := maga.Juego(m.Chat.ID, juego)
+			if err != nil {
+				pedidos.registroDe(m).Error("Error al buscar el acta del sorteo", err)
+			}
+			publicarRevelacion(cola, m.Chat, revelados, tablaDeAdivinanzas(adivinanzas), grupo, conSuspenso)
+			return nil
 		}
+		avisarError := func(err error) {
+			pedidos.fallo(m, err, "Error al revelar")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede revelar quién le regaló a quién")
+			} else if err.Error() == "noSorteado" {
+				cola.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá "+comando("/sortear", juego))
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, opcion)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude revelar ¿Ya creaste el grupo con /comenzar ?")
+			}
+		}
+
+		err := revelar(false)
+		if err == nil {
+			return
+		}
+		if err.Error() != "todaviaNoEsLaFecha" {
+			avisarError(err)
+			return
+		}
+		pedirConfirmacion(cola, pedidos, confirmaciones, m, "Todavía no llegó la fecha del intercambio ¿Revelo igual quién le regala a quién?", func() {
+			err := revelar(true)
+			if err != nil {
+				avisarError(err)
+			}
+		})
 	})
 
-	b.Handle("/notificar", func(m *tb.Message) {
-		sorteados, err := maga.ParticipantesConAmigxs(m.Chat.ID)
-		nombreDelGrupo := m.Chat.Title
-		if len(nombreDelGrupo) == 0 {
-			nombreDelGrupo = m.Chat.FirstName + " " + m.Chat.LastName
+	manejarComando(b, pedidos, "/adivinar", func(m *tb.Message) {
+		if !m.Private() {
+			cola.Send(m.Chat, "Las adivinanzas son secretas, mandame /adivinar por privado a @amigxinvisiblebot")
+			return
+		}
+		if len(strings.TrimSpace(m.Payload)) == 0 {
+			cola.Send(m.Chat, "Decime quién creés que te regala, por ejemplo /adivinar @usuario o /adivinar Nombre Apellido")
+			return
 		}
 
+		adivinado, titulo := separarTitulo(m.Payload)
+		grupo, grupos, err := maga.Adivinar(m.Sender.ID, titulo, adivinado)
 		if err != nil {
-			fmt.Println("Error al notificar", err)
+			pedidos.fallo(m, err, "Error al adivinar")
+			if err.Error() == "noEncontrado" {
+				cola.Send(m.Chat, "No encontré a "+m.Payload+" jugando con vos en ningún grupo que ya haya sorteado y todavía no haya revelado")
+			} else if err.Error() == "adivinanzaAmbigua" {
+				mensaje := adivinado + " juega con vos en varios grupos, decime en cuál:\n"
+				for _, grupo := range grupos {
+					mensaje += " * /adivinar " + adivinado + " en " + grupo.Titulo() + "\n"
+				}
+				cola.Send(m.Chat, mensaje)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude anotar tu adivinanza, probá más tarde")
+			}
+			return
+		}
+
+		cola.Send(m.Chat, "Listo, anoté que creés que "+adivinado+" te regala en "+grupo.Titulo()+"\nCuando revelen vas a ver si acertaste")
+	})
+
+	manejarComando(b, pedidos, "/estado", func(m *tb.Message) {
+		participantes, err := maga.EstadoDeNotificaciones(m.Chat.ID, m.Payload)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al buscar estado de notificaciones")
 			if err.Error() == "noSorteado" {
-				b.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá /sortear")
+				cola.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá "+comando("/sortear", m.Payload))
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
 			} else {
-				b.Send(m.Chat, "Ups, no pude mandar los mensajes ¿Ya creaste el grupo con /comenzar y sorteaste con /sortear ?")
+				cola.Send(m.Chat, "Ups, no pude ver el estado de los mensajes ¿Ya creaste el grupo con /comenzar ?")
 			}
+			return
+		}
+
+		faltan := ""
+		for _, participante := range participantes {
+			if !participante.FueNotificado() {
+				faltan += " * " + mencion(participante.Destinatario(), participante.Nombre) + "\n"
+			}
+		}
+		if len(faltan) == 0 {
+			cola.Send(m.Chat, "Todas las personas ya recibieron el nombre de su amigx")
 		} else {
-			mandarMensajes(b, m.Chat, sorteados, nombreDelGrupo)
+			cola.Send(m.Chat, "Todavía no les pude avisar a:\n"+faltan+"Vayan a @amigxinvisiblebot y toquen Start, ahí les llega el mensaje", tb.ModeHTML)
+		}
+	})
+
+	manejarComando(b, pedidos, "/listo", func(m *tb.Message) {
+		marcarRegalo(cola, pedidos, maga, m, maga.Compro, "Genial "+mencion(m.Sender.ID, m.Sender.FirstName)+", anoté que ya tenés el regalo para tu amigx")
+	})
+
+	manejarComando(b, pedidos, "/recibi", func(m *tb.Message) {
+		marcarRegalo(cola, pedidos, maga, m, maga.Recibio, "Qué lindo "+mencion(m.Sender.ID, m.Sender.FirstName)+", anoté que ya recibiste tu regalo")
+	})
+
+	manejarComando(b, pedidos, "/progreso", func(m *tb.Message) {
+		opcion, juego := primeraPalabra(m.Payload)
+		recordar := opcion == "recordar"
+		if !recordar {
+			opcion, juego = "", m.Payload
+		}
+
+		progreso, err := maga.Progreso(m.Chat.ID, juego, m.Sender.ID)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al buscar el progreso")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede ver el progreso")
+			} else if err.Error() == "noSorteado" {
+				cola.Send(m.Chat, "No hice el sorteo en este grupo, si querés sortear mandá "+comando("/sortear", juego))
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, opcion)
+			} else {
+				cola.Send(m.Chat, "Ups, no pude ver el progreso ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+
+		resumen := fmt.Sprintf("De %d personas, %d ya compraron su regalo y %d ya recibieron el suyo", progreso.Participantes, progreso.Compraron, progreso.Recibieron)
+		if !recordar {
+			if len(progreso.SinComprar) > 0 {
+				resumen += "\nSi querés que le avise por privado a quienes todavía no compraron mandá " + comando("/progreso recordar", juego)
+			}
+			cola.Send(m.Chat, resumen)
+			return
+		}
+
+		cola.Send(m.Chat, resumen)
+		for _, participante := range progreso.SinComprar {
+			recordatorio := "Hola " + participante.Nombre + ", te recuerdo que tenés que comprar el regalo para tu amigx invisible en " + progreso.Grupo.Titulo() + ". Cuando lo tengas mandá " + comando("/listo", juego) + " en el grupo"
+			if !participante.TieneTelegram() {
+				recordatorio = "Hola, te recuerdo que " + participante.Nombre + " tiene que comprar el regalo para su amigx invisible en " + progreso.Grupo.Titulo()
+			}
+			_, err := cola.Send(&tb.User{ID: participante.Destinatario()}, recordatorio)
+			if err != nil {
+				pedidos.registroDe(m).Con("destinatario", participante.Destinatario()).Advertir("Error al recordarle", err)
+			}
 		}
 	})
 
-	b.Handle("/misgrupos", func(m *tb.Message) {
+	manejarComando(b, pedidos, "/misgrupos", func(m *tb.Message) {
 		gruposDeParticipante, err := maga.GruposDe(m.Sender.ID)
 		if err != nil {
-			fmt.Println("Error al listar grupos", err)
-			b.Send(m.Sender, "Ups, no pude encontrar tus grupos ¿Ya creaste alguno grupo con /comenzar y te sumaste con /sumame ?")
+			pedidos.fallo(m, err, "Error al listar grupos")
+			cola.Send(m.Sender, "Ups, no pude encontrar tus grupos ¿Ya creaste alguno grupo con /comenzar y te sumaste con /sumame ?")
 		} else {
 			if len(gruposDeParticipante) == 0 {
-				b.Send(m.Sender, "Todavía no te anotaste en ningún grupo, te podés sumar mandando /sumame en algún grupo")
+				cola.Send(m.Sender, "Todavía no te anotaste en ningún grupo, te podés sumar mandando /sumame en algún grupo")
 			} else {
 				listaDeGrupos := "Estás jugando en:\n"
-				for _, participante := range gruposDeParticipante {
-					listaDeGrupos += " * " + participante.Nombre + "\n"
+				for _, grupo := range gruposDeParticipante {
+					listaDeGrupos += " * " + grupo.Titulo() + "\n"
 				}
-				b.Send(m.Sender, listaDeGrupos)
+				cola.Send(m.Sender, listaDeGrupos)
 			}
 		}
 	})
 
-	b.Handle("/misamigxs", func(m *tb.Message) {
+	manejarComando(b, pedidos, "/misamigxs", func(m *tb.Message) {
 		gruposyAmigxs, err := maga.AmigxsDe(m.Sender.ID)
 		if err != nil {
-			fmt.Println("Error al listar amigxs", err)
-			b.Send(m.Sender, "Ups, no pude encontrar tus amigxs ¿Ya creaste algun grupo con /comenzar te sumaste con /sumame y sorteaste con /sortear ?")
+			pedidos.fallo(m, err, "Error al listar amigxs")
+			cola.Send(m.Sender, "Ups, no pude encontrar tus amigxs ¿Ya creaste algun grupo con /comenzar te sumaste con /sumame y sorteaste con /sortear ?")
 		} else {
 			if len(gruposyAmigxs) == 0 {
-				b.Send(m.Sender, "Todavía no tenés amigxs en ningún grupo, te podés sumar mandando /sumame en algún grupo y después sortear con /sortear")
+				cola.Send(m.Sender, "Todavía no tenés amigxs en ningún grupo, te podés sumar mandando /sumame en algún grupo y después sortear con /sortear")
 			} else {
 				listaDeGruposYAmigxs := "Estos son tus amigxs:\n"
 				for _, grupoAmigx := range gruposyAmigxs {
-					listaDeGruposYAmigxs += "\\* En el grupo *" + grupoAmigx.Grupo + "* le tenés que regalar a *" + grupoAmigx.Amigx + "*\n"
+					listaDeGruposYAmigxs += "\\* En el grupo *" + escaparMarkdown(grupoAmigx.Grupo) + "*"
+					if len(grupoAmigx.Juego) > 0 {
+						listaDeGruposYAmigxs += " en el juego *" + escaparMarkdown(grupoAmigx.Juego) + "*"
+					}
+					if grupoAmigx.ACargo {
+						listaDeGruposYAmigxs += " " + escaparMarkdown(grupoAmigx.Participante) + " le tiene que regalar a *" + escaparMarkdown(grupoAmigx.Amigx) + "*\n"
+					} else {
+						listaDeGruposYAmigxs += " le tenés que regalar a *" + escaparMarkdown(grupoAmigx.Amigx) + "*\n"
+					}
+					if len(grupoAmigx.Deseos) > 0 {
+						listaDeGruposYAmigxs += escaparMarkdown("  Le gustaría: "+grupoAmigx.Deseos) + "\n"
+					}
+					if len(grupoAmigx.Presupuesto) > 0 {
+						listaDeGruposYAmigxs += escaparMarkdown("  El presupuesto es "+grupoAmigx.Presupuesto) + "\n"
+					}
+				}
+				if enlaces != nil {
+					listaDeGruposYAmigxs += "\n[Miralos también en la web](" + enlaces.Enlace(m.Sender.ID, time.Now()) + ")" +
+						escaparMarkdown(", el enlace dura "+strconv.Itoa(int(enlaces.Vigencia().Hours()))+" horas y no lo compartas porque cualquiera que lo tenga puede ver a quién le regalás")
 				}
-				_, err := b.Send(m.Sender, listaDeGruposYAmigxs, tb.ModeMarkdownV2)
+				_, err := cola.Send(m.Sender, listaDeGruposYAmigxs, tb.ModeMarkdownV2)
 				if err != nil {
-					fmt.Println("Error al mandar lista de amigxs de", m.Sender.ID, err)
+					pedidos.registroDe(m).Advertir("Error al mandar lista de amigxs", err)
 				}
 			}
 		}
 	})
 
-	b.Handle("/terminar", func(m *tb.Message) {
-		err := maga.Borrar(m.Chat.ID)
+	manejarComando(b, pedidos, "/terminar", func(m *tb.Message) {
+		pedirConfirmacion(cola, pedidos, confirmaciones, m, "¿Termino el juego"+enElJuego(m.Payload)+"?", func() {
+			err := maga.Archivar(m.Chat.ID, m.Payload, m.Sender.ID)
+
+			if err != nil {
+				pedidos.fallo(m, err, "Error al archivar")
+				if err.Error() == "noEsOrganizador" {
+					cola.Send(m.Chat, "Sólo quien organiza el juego lo puede terminar")
+				} else if err.Error() == "juegoAmbiguo" {
+					avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+				} else {
+					cola.Send(m.Chat, "Ups, no pude terminar el juego, probá más tarde")
+				}
+			} else {
+				cola.Send(m.Chat, "Listo, terminé el juego y lo guardé en el /historial, si querés volver a jugar mandá /comenzar\n"+
+					"Si fue un error mandá "+comando("/restaurar", m.Payload)+" en los próximos "+strconv.Itoa(int(lamaga.PlazoParaRestaurar.Hours()/24))+" días")
+			}
+		})
+	})
+
+	manejarComando(b, pedidos, "/restaurar", func(m *tb.Message) {
+		grupo, err := maga.Restaurar(m.Chat.ID, m.Payload, m.Sender.ID)
 
 		if err != nil {
-			fmt.Println("Error al borrar", err)
-			b.Send(m.Chat, "Ups, no pude borrar el grupo, probá más tarde")
+			pedidos.fallo(m, err, "Error al restaurar")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organizó el juego lo puede restaurar")
+			} else if err.Error() == "plazoVencido" {
+				cola.Send(m.Chat, "Ya pasó demasiado tiempo desde que terminó ese juego, no lo puedo restaurar")
+			} else if err.Error() == "ya existe ese grupo" {
+				cola.Send(m.Chat, "Ya hay otro juego con el mismo nombre en este grupo, terminalo con /terminar antes de restaurar")
+			} else {
+				cola.Send(m.Chat, "Ups, no encontré ningún juego terminado para restaurar, fijate en el /historial")
+			}
 		} else {
-			b.Send(m.Chat, "Listo, ya borré todo, si querés volver a jugar mandá /comenzar")
+			cola.Send(m.Chat, "Listo, restauré "+grupo.Titulo()+", pueden seguir jugando")
+		}
+	})
+
+	manejarComando(b, pedidos, "/historial", func(m *tb.Message) {
+		grupos, err := maga.Historial(m.Chat.ID)
+
+		if err != nil {
+			pedidos.fallo(m, err, "Error al buscar historial")
+			cola.Send(m.Chat, "Ups, no pude encontrar los juegos anteriores, probá más tarde")
+		} else if len(grupos) == 0 {
+			cola.Send(m.Chat, "Todavía no terminó ningún juego en este grupo")
+		} else {
+			historial := "Estos son los juegos que ya terminaron:\n"
+			for _, grupo := range grupos {
+				historial += " * " + grupo.Titulo() + ", terminó el " + grupo.ArchivadoEn.Time.Format("02/01/2006") +
+					" con " + strconv.Itoa(len(grupo.Participantes)) + " participantes\n"
+			}
+			cola.Send(m.Chat, historial)
+		}
+	})
+
+	manejarComando(b, pedidos, "/registro", func(m *tb.Message) {
+		eventos, err := maga.Registro(m.Chat.ID, m.Payload, m.Sender.ID)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al buscar el registro")
+			if err.Error() == "noEsOrganizador" {
+				cola.Send(m.Chat, "Sólo quien organiza el juego puede ver el registro")
+			} else if err.Error() == "juegoAmbiguo" {
+				avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+			} else {
+				cola.Send(m.Chat, "Ups, no pude encontrar el registro ¿Ya creaste el grupo con /comenzar ?")
+			}
+			return
+		}
+
+		registroDelJuego := "Esto es lo que pasó en " + html.EscapeString(tituloDelJuego(maga, m)) + ":\n"
+		for _, evento := range eventos {
+			registroDelJuego += " * " + evento.Momento.Format(FormatoDeFecha+" 15:04") + " " + lineaDelRegistro(evento) + "\n"
+		}
+		err = mandarEnPartes(cola, m.Chat, registroDelJuego, tb.ModeHTML)
+		if err != nil {
+			pedidos.fallo(m, err, "Error al mandar el registro")
 		}
 	})
 
-	return b, nil
+	manejarComando(b, pedidos, "/purgar", func(m *tb.Message) {
+		pedirConfirmacion(cola, pedidos, confirmaciones, m, "¿Borro para siempre los juegos terminados"+enElJuego(m.Payload)+"? Después no se pueden restaurar", func() {
+			purgados, err := maga.Purgar(m.Chat.ID, m.Payload, m.Sender.ID)
+
+			if err != nil {
+				pedidos.fallo(m, err, "Error al purgar")
+				if err.Error() == "noEsOrganizador" {
+					cola.Send(m.Chat, "Sólo quien organizó los juegos los puede borrar para siempre")
+				} else {
+					cola.Send(m.Chat, "Ups, no pude borrar los juegos terminados, probá más tarde")
+				}
+			} else if purgados == 0 {
+				cola.Send(m.Chat, "No hay juegos terminados para borrar, fijate en el /historial")
+			} else {
+				cola.Send(m.Chat, "Listo, borré para siempre "+strconv.Itoa(purgados)+" juegos terminados")
+			}
+		})
+	})
+
+	manejarAdministracion(b, cola, pedidos, confirmaciones, maga, configuracion)
+
+	parar := make(chan struct{})
+	go reintentarNotificaciones(cola, maga, parar)
+	go pedidos.olvidarViejosCadaTanto(parar)
+
+	recibir := func(u *tb.Update) {
+		registroDeLaActualizacion := pedidos.registroDeActualizacion(u)
+		actualizarIdentidad(maga, u, registroDeLaActualizacion)
+		migrarDesde(maga, u, registroDeLaActualizacion)
+	}
+
+	return &Bot{Bot: b, Notificador: NewNotificador(cola, maga), cola: cola, maga: maga, webhook: webhook, pedidos: pedidos, recibir: recibir, detener: make(chan struct{}), parar: parar}, nil
 }
 
-func mandarMensajes(b *tb.Bot, chat *tb.Chat, sorteados []*modelo.Participante, nombreDelGrupo string) {
-	var err error
-	notifiquéA := 0
+func mandarMensajes(cola *Cola, maga *lamaga.LaMaga, chat *tb.Chat, sorteados []*modelo.Participante, nombreDelGrupo string) {
+	cola.Trabajo(func() {
+		mandarMensajesA(cola, maga, chat, sorteados, nombreDelGrupo)
+	})
+}
+
+func mandarMensajesA(cola *Cola, maga *lamaga.LaMaga, chat *tb.Chat, sorteados []*modelo.Participante, nombreDelGrupo string) {
+	noPudeNotificar := false
 	for _, participante := range sorteados {
-		mensaje := "Hola, " + participante.Nombre +
-			" soy La Maga y te escribo porque estás jugando al amigx invisible en el grupo " + nombreDelGrupo +
-			". La persona a la que le tenés que hacer un regalo es: " + participante.Amigx.Nombre + "!! Pensá en algo lindo para regalarle!"
-		_, err = b.Send(&tb.User{ID: participante.Identificador}, mensaje)
+		if participante.SeFue {
+			continue
+		}
+		if !notificar(cola, maga, participante, nombreDelGrupo) {
+			noPudeNotificar = true
+			cola.Send(chat, mencion(participante.Destinatario(), participante.Nombre)+" no te pude mandar un mensaje, andá a @amigxinvisiblebot y tocá Start", tb.ModeHTML)
+		}
+	}
+	if noPudeNotificar {
+		cola.Send(chat, "Ups, no le pude mandar el mensaje a algunas personas, les voy a volver a escribir más tarde o cuando toquen Start en @amigxinvisiblebot. Para ver a quiénes les falta mandá /estado")
+	} else {
+		cola.Send(chat, "Listo, cada participante recibió un mensaje privado con el nombre de la persona a la que le tiene que regalar algo")
+	}
+}
+
+func notificar(cola *Cola, maga *lamaga.LaMaga, participante *modelo.Participante, nombreDelGrupo string) bool {
+	reclamada, err := maga.ReclamarNotificacion(participante)
+	if err != nil {
+		cola.registro.Con("participante", participante.ID).Error("Error al reclamar la notificación", err)
+		return false
+	}
+	if !reclamada {
+		// Ya la está mandando otrx o la persona se fue
+		return true
+	}
+
+	mensaje := "Hola, " + participante.Nombre +
+		" soy La Maga y te escribo porque estás jugando al amigx invisible en el grupo " + nombreDelGrupo +
+		". " + aQuienesRegala(participante)
+	if !participante.TieneTelegram() {
+		mensaje = "Hola, soy La Maga y te escribo porque " + participante.Nombre +
+			" está jugando al amigx invisible en el grupo " + nombreDelGrupo + " y no tiene Telegram, así que le vas a tener que contar vos. " +
+			aQuienesRegala(participante)
+	}
+	_, err = cola.Send(&tb.User{ID: participante.Destinatario()}, mensaje)
+	if err != nil {
+		metricas.Notificaciones.WithLabelValues("fallida").Inc()
+		cola.registro.Con("participante", participante.ID).Con("destinatario", participante.Destinatario()).Advertir("Error al notificar", err)
+		if err := maga.NoSePudoNotificar(participante, err.Error()); err != nil {
+			cola.registro.Con("participante", participante.ID).Error("Error al guardar notificación fallida", err)
+		}
+		return false
+	}
+
+	metricas.Notificaciones.WithLabelValues("entregada").Inc()
+	if err := maga.Notificado(participante); err != nil {
+		cola.registro.Con("participante", participante.ID).Error("Error al guardar notificación enviada", err)
+	}
+	return true
+}
+
+func reintentarNotificaciones(cola *Cola, maga *lamaga.LaMaga, parar <-chan struct{}) {
+	ticker := time.NewTicker(modelo.EsperaEntreIntentos)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-parar:
+			return
+		case <-ticker.C:
+		}
+
+		notificaciones, err := maga.NotificacionesParaReintentar(time.Now())
+		if err != nil {
+			cola.registro.Error("Error al buscar notificaciones para reintentar", err)
+			continue
+		}
+		cola.Trabajo(func() {
+			for _, notificacion := range notificaciones {
+				notificar(cola, maga, notificacion.Participante, notificacion.Grupo)
+			}
+		})
+	}
+}
+
+func nombreDelChat(chat *tb.Chat) string {
+	if len(chat.Title) > 0 {
+		return chat.Title
+	}
+	return modelo.NombreCompleto(chat.FirstName, chat.LastName)
+}
+
+func mencion(identificador int, nombre string) string {
+	return "<a href=\"tg://user?id=" + strconv.Itoa(identificador) + "\">" + html.EscapeString(nombre) + "</a>"
+}
+
+func actualizarIdentidad(maga *lamaga.LaMaga, u *tb.Update, registro *bitacora.Bitacora) {
+	var usuario *tb.User
+	if u.Message != nil {
+		usuario = u.Message.Sender
+	} else if u.Callback != nil {
+		usuario = u.Callback.Sender
+	}
+	if usuario == nil {
+		return
+	}
+
+	err := maga.ActualizarIdentidad(usuario.ID, usuario.Username, usuario.FirstName, usuario.LastName)
+	if err != nil {
+		registro.Error("Error al actualizar identidad", err)
+	}
+}
+
+// Cuando un grupo pasa a supergrupo Telegram manda un mensaje en cada chat.
+// Sólo se atiende el del chat nuevo, que además trae el nombre
+func migrarDesde(maga *lamaga.LaMaga, u *tb.Update, registro *bitacora.Bitacora) {
+	if u.Message == nil || u.Message.MigrateFrom == 0 {
+		return
+	}
+
+	err := maga.Migrar(u.Message.MigrateFrom, u.Message.Chat.ID)
+	if err == nil {
+		err = maga.Renombrar(u.Message.Chat.ID, nombreDelChat(u.Message.Chat))
+	}
+	if err != nil {
+		registro.Con("desde", u.Message.MigrateFrom).Error("Error al migrar grupo", err)
+	}
+}
+
+const FormatoDeFecha = "02/01/2006"
+
+const EsperaEntreRevelaciones = 5 * time.Second
+
+func publicarRevelacion(cola *Cola, chat *tb.Chat, revelados []*modelo.Participante, tablaDeAdivinanzas string, grupo *modelo.Grupo, conSuspenso bool) {
+	if !conSuspenso {
+		revelacion := "Llegó el momento de contar quién le regaló a quién:\n"
+		for _, participante := range revelados {
+			revelacion += " * " + participante.Nombre + " le regaló a " + nombresDeAmigxs(participante) + "\n"
+		}
+		cola.Send(chat, revelacion)
+		if len(tablaDeAdivinanzas) > 0 {
+			cola.Send(chat, tablaDeAdivinanzas)
+		}
+		publicarActa(cola, chat, grupo)
+		return
+	}
+
+	cola.EnSegundoPlano(func() {
+		cola.Send(chat, "Llegó el momento de contar quién le regaló a quién... de a une")
+		for _, participante := range revelados {
+			time.Sleep(EsperaEntreRevelaciones)
+			cola.Send(chat, participante.Nombre+" le regaló a... "+nombresDeAmigxs(participante)+"!")
+		}
+		if len(tablaDeAdivinanzas) > 0 {
+			time.Sleep(EsperaEntreRevelaciones)
+			cola.Send(chat, tablaDeAdivinanzas)
+		}
+		cola.Send(chat, "Eso es todo, gracias por jugar!")
+		publicarActa(cola, chat, grupo)
+	})
+}
+
+func publicarCompromiso(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message) {
+	grupo, err := maga.Juego(m.Chat.ID, m.Payload)
+	if err != nil {
+		pedidos.registroDe(m).Error("Error al buscar el compromiso del sorteo", err)
+		return
+	}
+	mandarCompromiso(cola, m.Chat, grupo.Compromiso)
+}
+
+func mandarCompromiso(cola *Cola, chat *tb.Chat, compromiso string) {
+	if len(compromiso) == 0 {
+		return
+	}
+	cola.Send(chat, "Para que nadie pueda hacer trampa este es el compromiso del sorteo:\n<code>"+compromiso+"</code>\nGuárdenlo, cuando revelen les mando el acta para que lo puedan verificar", tb.ModeHTML)
+}
+
+// Los sorteos viejos no tienen acta
+func publicarActa(cola *Cola, chat *tb.Chat, grupo *modelo.Grupo) {
+	if grupo == nil || len(grupo.Acta) == 0 {
+		return
+	}
+	acta := &tb.Document{
+		File:     tb.FromReader(strings.NewReader(grupo.Acta)),
+		FileName: "sorteo.json",
+		Caption:  "Esta es el acta del sorteo, con la semilla cualquiera lo puede repetir y comprobar que no hubo trampa con go run ./cmd/verificar -compromiso " + grupo.Compromiso + " sorteo.json (si alguien se fue y reenlazaron, el acta tiene el sorteo original)",
+	}
+	_, err := cola.Send(chat, acta)
+	if err != nil {
+		cola.registro.Con("chat", chat.ID).Error("Error al mandar el acta del sorteo", err)
+	}
+}
+
+func lineaDelRegistro(evento lamaga.EventoDelJuego) string {
+	quien := "alguien"
+	if len(evento.Quien) > 0 {
+		quien = evento.Quien
+	}
+	if evento.Cuenta != 0 {
+		quien = mencion(evento.Cuenta, quien)
+	}
+	sobre := html.EscapeString(evento.Sobre)
+	if len(sobre) == 0 {
+		sobre = "alguien que ya no está"
+	}
+	detalle := html.EscapeString(evento.Detalle)
+
+	switch evento.Tipo {
+	case modelo.EventoCreado:
+		return quien + " creó el juego"
+	case modelo.EventoSumado:
+		if len(evento.Quien) > 0 && evento.Quien == evento.Sobre {
+			return quien + " se sumó"
+		}
+		return quien + " sumó a " + sobre
+	case modelo.EventoSeFue:
+		return quien + " se fue"
+	case modelo.EventoEquipo:
+		return quien + " se anotó en el equipo " + detalle
+	case modelo.EventoReglaDeEquipos:
+		return quien + " decidió que " + descripcionDeReglas[evento.Detalle]
+	case modelo.EventoHermanxs:
+		if evento.Detalle == "true" {
+			return quien + " decidió que lxs hermanxs se pueden regalar"
+		}
+		return quien + " decidió que lxs hermanxs no se regalan"
+	case modelo.EventoRegalosPorPersona:
+		return quien + " decidió que cada persona hace " + detalle + " regalos"
+	case modelo.EventoSorteado:
+		return quien + " sorteó entre " + detalle + " personas"
+	case modelo.EventoRenotificado:
+		if evento.Detalle == "administracion" {
+			return "Se le volvió a mandar su amigx a cada participante"
+		}
+		return quien + " le volvió a mandar su amigx a cada participante"
+	case modelo.EventoReenlazado:
+		return quien + " reenlazó a " + detalle + " personas"
+	case modelo.EventoFecha:
+		fecha, err := time.Parse("2006-01-02", evento.Detalle)
 		if err == nil {
-			notifiquéA++
+			detalle = fecha.Format(FormatoDeFecha)
+		}
+		return quien + " puso la fecha del intercambio el " + detalle
+	case modelo.EventoPresupuesto:
+		return quien + " puso el presupuesto en " + detalle
+	case modelo.EventoDeseos:
+		return quien + " anotó lo que le gustaría recibir"
+	case modelo.EventoCompro:
+		return quien + " compró su regalo"
+	case modelo.EventoRecibio:
+		return quien + " recibió su regalo"
+	case modelo.EventoAdivino:
+		return quien + " adivinó quién le regala"
+	case modelo.EventoRevelado:
+		return quien + " reveló quién le regaló a quién"
+	case modelo.EventoTerminado:
+		return quien + " terminó el juego"
+	case modelo.EventoRestaurado:
+		return quien + " restauró el juego"
+	}
+	return quien + " " + html.EscapeString(evento.Tipo)
+}
+
+func aQuienesRegala(participante *modelo.Participante) string {
+	if !participante.TieneTelegram() {
+		if len(participante.Amigxs) == 1 {
+			return "La persona a la que " + participante.Nombre + " le tiene que hacer un regalo es: " + participante.Amigxs[0].Nombre + "!!"
+		}
+		return "Las personas a las que " + participante.Nombre + " les tiene que hacer un regalo son: " + nombresDeAmigxs(participante) + "!!"
+	}
+	if len(participante.Amigxs) == 1 {
+		return "La persona a la que le tenés que hacer un regalo es: " + participante.Amigxs[0].Nombre + "!! Pensá en algo lindo para regalarle!"
+	}
+	return "Las personas a las que les tenés que hacer un regalo son: " + nombresDeAmigxs(participante) + "!! Pensá en algo lindo para cada une!"
+}
+
+func nombresDeAmigxs(participante *modelo.Participante) string {
+	nombres := make([]string, 0, len(participante.Amigxs))
+	for _, amigx := range participante.Amigxs {
+		nombres = append(nombres, amigx.Nombre)
+	}
+	if len(nombres) < 2 {
+		return strings.Join(nombres, "")
+	}
+	return strings.Join(nombres[:len(nombres)-1], ", ") + " y " + nombres[len(nombres)-1]
+}
+
+func tablaDeAdivinanzas(adivinanzas []lamaga.Adivinanza) string {
+	acertaron := ""
+	fallaron := ""
+	for _, adivinanza := range adivinanzas {
+		if adivinanza.Adivinado == nil {
+			continue
+		}
+		if adivinanza.Acerto {
+			acertaron += " * " + adivinanza.Participante.Nombre + "\n"
 		} else {
-			fmt.Println("Error al notificar", err)
-			b.Send(chat, participante.Nombre+" no te pude mandar un mensaje, andá a @amigxinvisiblebot y tocá Start")
+			fallaron += " * " + adivinanza.Participante.Nombre + " creía que era " + adivinanza.Adivinado.Nombre + "\n"
+		}
+	}
+
+	if len(acertaron) == 0 && len(fallaron) == 0 {
+		return ""
+	}
+	tabla := "¿Quién adivinó quién le regalaba?\n"
+	if len(acertaron) > 0 {
+		tabla += "Acertaron:\n" + acertaron
+	}
+	if len(fallaron) > 0 {
+		tabla += "No acertaron:\n" + fallaron
+	}
+	return tabla
+}
+
+// Los comandos que reciben un nombre llevan el juego después de un punto y coma
+func separarJuego(texto string) (string, string) {
+	partes := strings.SplitN(texto, ";", 2)
+	if len(partes) < 2 {
+		return strings.TrimSpace(partes[0]), ""
+	}
+	return strings.TrimSpace(partes[0]), strings.TrimSpace(partes[1])
+}
+
+func primeraPalabra(texto string) (string, string) {
+	partes := strings.SplitN(strings.TrimSpace(texto), " ", 2)
+	if len(partes) < 2 {
+		return partes[0], ""
+	}
+	return partes[0], strings.TrimSpace(partes[1])
+}
+
+var reglasDeEquipos = map[string]string{
+	"distintos": modelo.EquiposDistintos,
+	"mismo":     modelo.MismoEquipo,
+	"libre":     modelo.EquiposSinRegla,
+}
+
+var descripcionDeReglas = map[string]string{
+	modelo.EquiposDistintos: "cada persona le va a regalar a alguien de otro equipo",
+	modelo.MismoEquipo:      "cada persona le va a regalar a alguien de su equipo",
+	modelo.EquiposSinRegla:  "no voy a tener en cuenta los equipos",
+}
+
+var botonConfirmar = tb.InlineButton{Unique: "confirmar", Text: "Sí"}
+var botonCancelar = tb.InlineButton{Unique: "cancelar", Text: "No"}
+
+func avisarSalidas(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message) {
+	salidas, err := maga.SeFue(m.Chat.ID, m.UserLeft.ID)
+	if err != nil {
+		pedidos.registroDe(m).Con("participante", m.UserLeft.ID).Error("Error al sacar del grupo", err)
+		return
+	}
+
+	for _, salida := range salidas {
+		grupo := salida.Grupo
+		mencionDelParticipante := mencion(salida.Participante.Identificador, salida.Participante.Nombre)
+		if !grupo.YaSorteo {
+			cola.Send(m.Chat, mencionDelParticipante+" se fue del grupo, así que ya no participa de "+html.EscapeString(grupo.Titulo()), tb.ModeHTML)
+			continue
 		}
+
+		aviso := mencionDelParticipante + " se fue del grupo después del sorteo y alguien se quedó sin amigx. " +
+			"Quien organiza puede mandar " + html.EscapeString(comando("/reenlazar", grupo.Juego)) + " en el grupo para que la persona que le regalaba le regale a su amigx"
+		if grupo.Organizador != 0 {
+			_, err = cola.Send(&tb.User{ID: grupo.Organizador}, aviso+" (en "+html.EscapeString(grupo.Titulo())+")", tb.ModeHTML)
+			if err == nil {
+				continue
+			}
+			pedidos.registroDe(m).Con("organizador", grupo.Organizador).Advertir("Error al avisarle a quien organiza", err)
+		}
+		cola.Send(m.Chat, aviso, tb.ModeHTML)
+	}
+}
+
+func pedirConfirmacion(cola *Cola, pedidos *pedidosEnCurso, confirmaciones *Confirmaciones, m *tb.Message, pregunta string, accion func()) {
+	nombre := nombreDelComando(m)
+	identificador, err := confirmaciones.Nueva(m.Sender.ID, func() {
+		pedidos.medir(nombre, m, accion)
+	})
+	if err != nil {
+		pedidos.fallo(m, err, "Error al pedir confirmación")
+		cola.Send(m.Chat, "Ups, no pude preguntarte si estás segurx, probá más tarde")
+		return
 	}
-	if notifiquéA < len(sorteados) {
-		b.Send(chat, "Ups, no le pude mandar el mensaje a algunas personas, probá de nuevo en un rato")
+
+	si := botonConfirmar
+	si.Data = identificador
+	no := botonCancelar
+	no.Data = identificador
+	pedidos.esperarConfirmacion(m)
+	cola.Send(m.Chat, pregunta, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{si, no}}})
+}
+
+func responderConfirmacion(cola *Cola, pedidos *pedidosEnCurso, confirmaciones *Confirmaciones, c *tb.Callback, confirmar bool) {
+	var accion func()
+	var err error
+	if confirmar {
+		accion, err = confirmaciones.Confirmar(c.Data, c.Sender.ID)
 	} else {
-		b.Send(chat, "Listo, cada participante recibió un mensaje privado con el nombre de la persona a la que le tiene que regalar algo")
+		err = confirmaciones.Cancelar(c.Data, c.Sender.ID)
 	}
+
+	if err != nil {
+		pedidos.registroDelBoton(c).Con("confirmar", confirmar).Advertir("No se pudo responder la confirmación", err)
+		if err.Error() == "noEsQuienPidio" {
+			cola.Responder(c, &tb.CallbackResponse{Text: "Sólo quien mandó el comando puede responder"})
+		} else {
+			cola.Responder(c, &tb.CallbackResponse{Text: "Esta pregunta ya venció, mandá el comando de nuevo"})
+			cola.Editar(c.Message, c.Message.Text+"\n(Venció)")
+		}
+		return
+	}
+
+	cola.Responder(c, &tb.CallbackResponse{})
+	if !confirmar {
+		cola.Editar(c.Message, c.Message.Text+"\nNo, mejor no")
+		return
+	}
+	cola.Editar(c.Message, c.Message.Text+"\nSí")
+	accion()
 }
+
+func marcarRegalo(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message, marcar func(int64, string, int) error, respuesta string) {
+	if !m.FromGroup() {
+		cola.Send(m.Chat, "Mandá este comando en el grupo donde estás jugando")
+		return
+	}
+
+	err := marcar(m.Chat.ID, m.Payload, m.Sender.ID)
+	if err != nil {
+		pedidos.fallo(m, err, "Error al marcar el regalo")
+		if err.Error() == "noParticipa" {
+			cola.Send(m.Chat, "No estás participando"+enElJuego(m.Payload)+", si querés participar mandá "+comando("/sumame", m.Payload))
+		} else if err.Error() == "noSorteado" {
+			cola.Send(m.Chat, "Todavía no hice el sorteo, si querés sortear mandá "+comando("/sortear", m.Payload))
+		} else if err.Error() == "juegoAmbiguo" {
+			avisarJuegoAmbiguo(cola, pedidos, maga, m, "")
+		} else {
+			cola.Send(m.Chat, "Ups, no pude anotarlo ¿Ya creaste el grupo con /comenzar ?")
+		}
+		return
+	}
+	cola.Send(m.Chat, respuesta, tb.ModeHTML)
+}
+
+func enElJuego(juego string) string {
+	if len(juego) == 0 {
+		return ""
+	}
+	return " de " + juego
+}
+
+func comando(nombre string, juego string) string {
+	if len(juego) == 0 {
+		return nombre
+	}
+	return nombre + " " + juego
+}
+
+func tituloDelJuego(maga *lamaga.LaMaga, m *tb.Message) string {
+	grupo, err := maga.Juego(m.Chat.ID, m.Payload)
+	if err != nil {
+		return nombreDelChat(m.Chat)
+	}
+	return grupo.Titulo()
+}
+
+// "/adivinar Juli en Los primos" adivina sólo en el grupo Los primos
+func separarTitulo(texto string) (string, string) {
+	separador := strings.LastIndex(texto, " en ")
+	if separador < 0 {
+		return strings.TrimSpace(texto), ""
+	}
+	return strings.TrimSpace(texto[:separador]), strings.TrimSpace(texto[separador+len(" en "):])
+}
+
+// El argumento es lo que va antes del juego, así la sugerencia hace lo mismo
+// que se pidió, por ejemplo /regalos 2 Navidad
+func avisarJuegoAmbiguo(cola *Cola, pedidos *pedidosEnCurso, maga *lamaga.LaMaga, m *tb.Message, argumento string) {
+	juegos, err := maga.Juegos(m.Chat.ID)
+	if err != nil {
+		pedidos.fallo(m, err, "Error al listar juegos")
+		cola.Send(m.Chat, "Ups, no pude encontrar los juegos de este grupo, probá más tarde")
+		return
+	}
+
+	nombres := make([]string, 0, len(juegos))
+	for _, juego := range juegos {
+		nombres = append(nombres, juego.Juego)
+	}
+	cola.Send(m.Chat, ElegirJuego(nombreDelComando(m), argumento, nombres))
+}
+
+func escaparMarkdown(texto string) string {
+	return markdownV2.Replace(texto)
+}
+
+var markdownV2 = strings.NewReplacer(
+	"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "~", "\\~", "`", "\\`",
+	">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}",
+	".", "\\.", "!", "\\!", "\\", "\\\\",
+)